@@ -0,0 +1,312 @@
+package algorithm
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// the z value of the 95% confidence intervals
+const CONFIDENCE_Z = 1.96
+
+// percentile of a sorted slice, by nearest rank
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[percentileRank(len(sorted), q)]
+}
+
+func percentileInt(sorted []int, q float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[percentileRank(len(sorted), q)]
+}
+
+// percentileRank is the index of the q percentile of n sorted values, by nearest rank
+func percentileRank(n int, q float64) int {
+	rank := int(math.Ceil(q*float64(n))) - 1
+	if rank < 0 {
+		return 0
+	}
+	if rank >= n {
+		return n - 1
+	}
+	return rank
+}
+
+// wilsonInterval is the Wilson score interval of a proportion of successes out of n trials
+func wilsonInterval(successes int, n int, z float64) (low float64, high float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	p := float64(successes) / float64(n)
+	trials := float64(n)
+	center := (p + z*z/(2*trials)) / (1 + z*z/trials)
+	margin := z / (1 + z*z/trials) * math.Sqrt(p*(1-p)/trials+z*z/(4*trials*trials))
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+// RunConfig is what makes runs repetitions of the same experiment
+type RunConfig struct {
+	Size          int
+	RoundDuration time.Duration
+	Offset        int
+	F             float64
+	G             float64
+	L             int
+	X             int
+	Delta         float64
+}
+
+func runConfig(run *RunRecord) RunConfig {
+	params := run.Summary.Params
+	size := run.Peers
+	if size == 0 {
+		size = run.Summary.Nodes
+	}
+	return RunConfig{size, params.RoundDuration, params.Offset, params.F, params.G, params.L, params.X, params.Delta}
+}
+
+func (c RunConfig) less(o RunConfig) bool {
+	switch {
+	case c.Size != o.Size:
+		return c.Size < o.Size
+	case c.RoundDuration != o.RoundDuration:
+		return c.RoundDuration < o.RoundDuration
+	case c.Offset != o.Offset:
+		return c.Offset < o.Offset
+	case c.F != o.F:
+		return c.F < o.F
+	case c.G != o.G:
+		return c.G < o.G
+	case c.L != o.L:
+		return c.L < o.L
+	case c.X != o.X:
+		return c.X < o.X
+	}
+	return c.Delta < o.Delta
+}
+
+// RunGroup aggregates the runs of a configuration; the time, messages and bytes are pooled over the nodes of every run
+type RunGroup struct {
+	Config      RunConfig
+	Runs        int
+	Consensus   int
+	Probability float64
+	Low         float64 // of the 95% confidence interval of Probability
+	High        float64
+	TimeMedian  time.Duration
+	TimeP90     time.Duration
+	MsgMedian   int
+	MsgP90      int
+	BytesMedian int
+	BytesP90    int
+}
+
+func aggregateRuns(config RunConfig, runs []*RunRecord) RunGroup {
+	group := RunGroup{Config: config, Runs: len(runs)}
+	times := make([]time.Duration, 0)
+	msgs := make([]int, 0)
+	bytes := make([]int, 0)
+	for _, run := range runs {
+		if run.Consensus {
+			group.Consensus++
+		}
+		if len(run.Nodes) == 0 {
+			// a run saved without its nodes counts by its medians
+			times = append(times, run.Summary.TimeMedian)
+			msgs = append(msgs, run.Summary.MsgMedian)
+			bytes = append(bytes, run.Summary.BytesMedian)
+			continue
+		}
+		for _, node := range run.Nodes {
+			if node.Finished {
+				times = append(times, node.Duration)
+			}
+			msgs = append(msgs, node.MsgCount)
+			bytes = append(bytes, node.ByteCount)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	sort.Ints(msgs)
+	sort.Ints(bytes)
+	group.Probability = float64(group.Consensus) / float64(group.Runs)
+	group.Low, group.High = wilsonInterval(group.Consensus, group.Runs, CONFIDENCE_Z)
+	group.TimeMedian, group.TimeP90 = percentile(times, 0.5), percentile(times, 0.9)
+	group.MsgMedian, group.MsgP90 = percentileInt(msgs, 0.5), percentileInt(msgs, 0.9)
+	group.BytesMedian, group.BytesP90 = percentileInt(bytes, 0.5), percentileInt(bytes, 0.9)
+	return group
+}
+
+// groupRuns aggregates the runs by the configuration key picks out of them
+func groupRuns(runs []RunRecord, key func(c RunConfig) RunConfig) []RunGroup {
+	byConfig := make(map[RunConfig][]*RunRecord)
+	for i, _ := range runs {
+		config := key(runConfig(&runs[i]))
+		byConfig[config] = append(byConfig[config], &runs[i])
+	}
+	groups := make([]RunGroup, 0, len(byConfig))
+	for config, members := range byConfig {
+		groups = append(groups, aggregateRuns(config, members))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Config.less(groups[j].Config) })
+	return groups
+}
+
+// Analysis is the statistics of saved runs: by configuration, and the consensus versus delta, f and g alone
+type Analysis struct {
+	Runs    int
+	Configs []RunGroup
+	Delta   []RunGroup
+	F       []RunGroup
+	G       []RunGroup
+}
+
+func AnalyzeRuns(runs []RunRecord) Analysis {
+	return Analysis{
+		Runs:    len(runs),
+		Configs: groupRuns(runs, func(c RunConfig) RunConfig { return c }),
+		Delta:   groupRuns(runs, func(c RunConfig) RunConfig { return RunConfig{Delta: c.Delta} }),
+		F:       groupRuns(runs, func(c RunConfig) RunConfig { return RunConfig{F: c.F} }),
+		G:       groupRuns(runs, func(c RunConfig) RunConfig { return RunConfig{G: c.G} }),
+	}
+}
+
+func formatInterval(g RunGroup) string {
+	return fmt.Sprintf("[%.3f, %.3f]", g.Low, g.High)
+}
+
+// WriteText writes the analysis as tables
+func (a Analysis) WriteText(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "%d runs, by configuration\n", a.Runs)
+	fmt.Fprintf(table, "n\tduration\toffset\tf\tg\tl\tx\tdelta\truns\tconsensus\tp\t95%% CI\ttime p50\ttime p90\tmsgs p50\tmsgs p90\tbytes p50\tbytes p90\t\n")
+	for _, g := range a.Configs {
+		c := g.Config
+		fmt.Fprintf(table, "%d\t%s\t%d\t%g\t%g\t%d\t%d\t%g\t%d\t%d\t%.3f\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t\n",
+			c.Size, c.RoundDuration, c.Offset, c.F, c.G, c.L, c.X, c.Delta, g.Runs, g.Consensus, g.Probability,
+			formatInterval(g), g.TimeMedian.Round(time.Millisecond), g.TimeP90.Round(time.Millisecond),
+			g.MsgMedian, g.MsgP90, g.BytesMedian, g.BytesP90)
+	}
+	sensitivity := []struct {
+		name   string
+		groups []RunGroup
+		value  func(c RunConfig) float64
+	}{
+		{"delta", a.Delta, func(c RunConfig) float64 { return c.Delta }},
+		{"f", a.F, func(c RunConfig) float64 { return c.F }},
+		{"g", a.G, func(c RunConfig) float64 { return c.G }},
+	}
+	for _, s := range sensitivity {
+		fmt.Fprintf(table, "\nconsensus versus %s, over every other parameter\n", s.name)
+		fmt.Fprintf(table, "%s\truns\tconsensus\tp\t95%% CI\ttime p50\tmsgs p50\tbytes p50\t\n", s.name)
+		for _, g := range s.groups {
+			fmt.Fprintf(table, "%g\t%d\t%d\t%.3f\t%s\t%s\t%d\t%d\t\n", s.value(g.Config), g.Runs, g.Consensus, g.Probability,
+				formatInterval(g), g.TimeMedian.Round(time.Millisecond), g.MsgMedian, g.BytesMedian)
+		}
+	}
+	return table.Flush()
+}
+
+var configHeader = []string{"n", "round_duration_ms", "offset", "f", "g", "l", "x", "delta"}
+var groupHeader = []string{"runs", "consensus", "p_consensus", "ci_low", "ci_high", "time_median_ms", "time_p90_ms",
+	"msgs_median", "msgs_p90", "bytes_median", "bytes_p90"}
+
+func formatCSVFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func groupRecord(g RunGroup) []string {
+	return []string{
+		strconv.Itoa(g.Runs), strconv.Itoa(g.Consensus), formatCSVFloat(g.Probability),
+		formatCSVFloat(g.Low), formatCSVFloat(g.High),
+		strconv.FormatInt(g.TimeMedian.Milliseconds(), 10), strconv.FormatInt(g.TimeP90.Milliseconds(), 10),
+		strconv.Itoa(g.MsgMedian), strconv.Itoa(g.MsgP90), strconv.Itoa(g.BytesMedian), strconv.Itoa(g.BytesP90),
+	}
+}
+
+// writeGroupsCSV writes a line per group; param names the one parameter of a sensitivity table,
+// empty for the whole configuration
+func writeGroupsCSV(w io.Writer, groups []RunGroup, param string) error {
+	writer := csv.NewWriter(w)
+	if param == "" {
+		writer.Write(append(append([]string{}, configHeader...), groupHeader...))
+	} else {
+		writer.Write(append([]string{param}, groupHeader...))
+	}
+	for _, g := range groups {
+		c := g.Config
+		var record []string
+		switch param {
+		case "":
+			record = []string{strconv.Itoa(c.Size), strconv.FormatInt(c.RoundDuration.Milliseconds(), 10), strconv.Itoa(c.Offset),
+				formatCSVFloat(c.F), formatCSVFloat(c.G), strconv.Itoa(c.L), strconv.Itoa(c.X), formatCSVFloat(c.Delta)}
+		case "delta":
+			record = []string{formatCSVFloat(c.Delta)}
+		case "f":
+			record = []string{formatCSVFloat(c.F)}
+		case "g":
+			record = []string{formatCSVFloat(c.G)}
+		}
+		writer.Write(append(record, groupRecord(g)...))
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteCSV writes configs.csv, delta.csv, f.csv and g.csv to dir
+func (a Analysis) WriteCSV(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tables := []struct {
+		file   string
+		groups []RunGroup
+		param  string
+	}{
+		{"configs.csv", a.Configs, ""},
+		{"delta.csv", a.Delta, "delta"},
+		{"f.csv", a.F, "f"},
+		{"g.csv", a.G, "g"},
+	}
+	for _, t := range tables {
+		f, err := os.Create(filepath.Join(dir, t.file))
+		if err != nil {
+			return err
+		}
+		err = writeGroupsCSV(f, t.groups, t.param)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AnalyzeRunFiles analyzes the runs saved in the files, and writes the tables to w and the csv files to csvDir if given
+func AnalyzeRunFiles(files []string, csvDir string, w io.Writer) error {
+	runs, err := readRunFiles(files)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("no runs to analyze")
+	}
+	analysis := AnalyzeRuns(runs)
+	if err = analysis.WriteText(w); err != nil {
+		return err
+	}
+	if csvDir != "" {
+		return analysis.WriteCSV(csvDir)
+	}
+	return nil
+}
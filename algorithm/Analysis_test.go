@@ -0,0 +1,105 @@
+package algorithm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWilsonInterval(t *testing.T) {
+	cases := []struct {
+		successes, n int
+		low, high    float64
+	}{
+		{8, 10, 0.4902, 0.9433},
+		{10, 10, 0.7225, 1},
+		{0, 20, 0, 0.1611},
+	}
+	for _, c := range cases {
+		low, high := wilsonInterval(c.successes, c.n, CONFIDENCE_Z)
+		if math.Abs(low-c.low) > 1e-3 || math.Abs(high-c.high) > 1e-3 {
+			t.Errorf("%d/%d: expected [%f, %f], got [%f, %f]", c.successes, c.n, c.low, c.high, low, high)
+		}
+	}
+}
+
+func TestPercentileInt(t *testing.T) {
+	sorted := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for q, expected := range map[float64]int{0: 1, 0.5: 5, 0.9: 9, 0.95: 10, 1: 10} {
+		if got := percentileInt(sorted, q); got != expected {
+			t.Errorf("percentile %f: expected %d, got %d", q, expected, got)
+		}
+	}
+	if percentileInt(nil, 0.5) != 0 || percentileInt([]int{3}, 0.9) != 3 {
+		t.Errorf("unexpected percentile of a short slice")
+	}
+}
+
+func testRun(size int, delta float64, consensus bool, durations ...time.Duration) RunRecord {
+	run := RunRecord{Peers: size, Consensus: consensus}
+	run.Summary.Params = DefaultSetupParams
+	run.Summary.Params.Delta = delta
+	for i, d := range durations {
+		run.Nodes = append(run.Nodes, NodeStatus{Finished: true, Duration: d, MsgCount: 10 * (i + 1), ByteCount: 1000 * (i + 1)})
+	}
+	return run
+}
+
+func TestAnalyzeRuns(t *testing.T) {
+	runs := []RunRecord{
+		testRun(20, 0.5, true, time.Second, 3*time.Second),
+		testRun(20, 0.5, false, 2*time.Second),
+		testRun(10, 0.5, true, time.Second),
+		testRun(10, 0.8, true, 4*time.Second),
+	}
+	var saved bytes.Buffer
+	for _, run := range runs {
+		json.NewEncoder(&saved).Encode(run)
+	}
+	read, err := ReadRuns(&saved)
+	if err != nil || len(read) != len(runs) {
+		t.Fatalf("unable to read the runs back: %v", err)
+	}
+	a := AnalyzeRuns(read)
+	if len(a.Configs) != 3 || a.Configs[0].Config.Size != 10 || a.Configs[2].Config.Size != 20 {
+		t.Fatalf("unexpected configurations %+v", a.Configs)
+	}
+	large := a.Configs[2]
+	if large.Runs != 2 || large.Consensus != 1 || large.Probability != 0.5 || large.TimeMedian != 2*time.Second ||
+		large.TimeP90 != 3*time.Second || large.MsgMedian != 10 || large.BytesP90 != 2000 {
+		t.Errorf("unexpected group %+v", large)
+	}
+	if len(a.Delta) != 2 || a.Delta[0].Config.Delta != 0.5 || a.Delta[0].Runs != 3 || a.Delta[1].Consensus != 1 {
+		t.Errorf("unexpected delta sensitivity %+v", a.Delta)
+	}
+	if len(a.F) != 1 || a.F[0].Runs != 4 {
+		t.Errorf("unexpected f sensitivity %+v", a.F)
+	}
+
+	var text bytes.Buffer
+	if err := a.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "4 runs, by configuration") || !strings.Contains(text.String(), "consensus versus delta") {
+		t.Errorf("unexpected tables\n%s", text.String())
+	}
+
+	dir := t.TempDir()
+	if err := a.WriteCSV(dir); err != nil {
+		t.Fatal(err)
+	}
+	delta, err := os.ReadFile(filepath.Join(dir, "delta.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(delta)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "delta,runs,consensus,p_consensus,ci_low") ||
+		!strings.HasPrefix(lines[1], "0.5,3,2,0.6666666666666666,") {
+		t.Errorf("unexpected delta.csv\n%s", delta)
+	}
+}
@@ -0,0 +1,386 @@
+package algorithm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JOB_RUNNING = "running"
+	JOB_DONE    = "done"
+	JOB_FAILED  = "failed"
+)
+
+// Job is a long-running controller operation started over the API, polled at /jobs/ID
+type Job struct {
+	Id       int
+	Kind     string
+	State    string // JOB_RUNNING, JOB_DONE or JOB_FAILED
+	Started  time.Time
+	Finished time.Time
+	Result   interface{} `json:",omitempty"`
+	Error    string      `json:",omitempty"`
+}
+
+// jobRegistry runs one job at a time, the operations share the nodes and SetupParams
+type jobRegistry struct {
+	lock sync.Mutex
+	next int
+	jobs []*Job
+}
+
+func (r *jobRegistry) start(kind string, run func() (interface{}, error)) (Job, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, job := range r.jobs {
+		if job.State == JOB_RUNNING {
+			return Job{}, fmt.Errorf("job %d (%s) is running", job.Id, job.Kind)
+		}
+	}
+	r.next++
+	job := &Job{Id: r.next, Kind: kind, State: JOB_RUNNING, Started: time.Now()}
+	r.jobs = append(r.jobs, job)
+	go func() {
+		result, err := run()
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		job.Finished = time.Now()
+		job.Result = result
+		job.State = JOB_DONE
+		if err != nil {
+			job.State = JOB_FAILED
+			job.Error = err.Error()
+		}
+	}()
+	return *job, nil
+}
+
+func (r *jobRegistry) get(id int) (Job, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, job := range r.jobs {
+		if job.Id == id {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+// last is the latest job of the kind
+func (r *jobRegistry) last(kind string) (Job, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := len(r.jobs) - 1; i >= 0; i-- {
+		if r.jobs[i].Kind == kind {
+			return *r.jobs[i], true
+		}
+	}
+	return Job{}, false
+}
+
+func (r *jobRegistry) latest() (Job, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.jobs) == 0 {
+		return Job{}, false
+	}
+	return *r.jobs[len(r.jobs)-1], true
+}
+
+func (r *jobRegistry) list() []Job {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	jobs := make([]Job, len(r.jobs))
+	for i, job := range r.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+// AutoRun is the outcome of one autoTest, kept for the batch status
+type AutoRun struct {
+	Size           int
+	Consensus      bool
+	ConsensusTime  time.Duration
+	ConsensusRound int
+	Report         string // the report line, see Data.Report
+	Finished       time.Time
+}
+
+// PeerInfo is a registered node as the API lists it
+type PeerInfo struct {
+	Address   string
+	Id        string
+	Malicious bool
+}
+
+// SpawnRequest is the body of POST /spawn, Host empty spawns evenly over the spawners
+type SpawnRequest struct {
+	Count int
+	Host  string
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// only lets the methods through
+func only(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range methods {
+			if r.Method == method {
+				handler(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+	}
+}
+
+// startJob answers with the job, to be polled at its Location
+func (c *ControllerState) startJob(w http.ResponseWriter, kind string, run func() (interface{}, error)) {
+	job, err := c.jobs.start(kind, run)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.Id))
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// apiHandler serves the console operations as JSON
+func (c *ControllerState) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/peers", only(c.apiPeers, http.MethodGet))
+	mux.HandleFunc("/servers", only(c.apiServers, http.MethodGet))
+	mux.HandleFunc("/params", only(c.apiParams, http.MethodGet, http.MethodPost))
+	mux.HandleFunc("/setup", only(func(w http.ResponseWriter, r *http.Request) {
+		c.startJob(w, "setup", func() (interface{}, error) {
+			return nil, c.SetupProtocol(1, nil)
+		})
+	}, http.MethodPost))
+	mux.HandleFunc("/start", only(func(w http.ResponseWriter, r *http.Request) {
+		c.startJob(w, "start", func() (interface{}, error) {
+			return nil, c.StartProtocol(1, nil)
+		})
+	}, http.MethodPost))
+	mux.HandleFunc("/report", only(c.apiReport, http.MethodGet))
+	mux.HandleFunc("/history", only(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, convergenceTrace(c.gatherHistories()))
+	}, http.MethodGet))
+	mux.HandleFunc("/measure", only(func(w http.ResponseWriter, r *http.Request) {
+		c.startJob(w, "measure", func() (interface{}, error) {
+			return c.measure(DefaultProbeParams), nil
+		})
+	}, http.MethodPost))
+	mux.HandleFunc("/spawn", only(c.apiSpawn, http.MethodPost))
+	mux.HandleFunc("/reset", only(func(w http.ResponseWriter, r *http.Request) {
+		c.KillNodes(1, nil)
+		writeJSON(w, http.StatusOK, map[string]int{"peers": 0})
+	}, http.MethodPost))
+	mux.HandleFunc("/netem", only(c.apiNetem, http.MethodGet, http.MethodPost))
+	mux.HandleFunc("/auto", only(c.apiAuto, http.MethodPost))
+	mux.HandleFunc("/batch", only(c.apiBatch, http.MethodGet, http.MethodPost))
+	mux.HandleFunc("/jobs", only(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.jobs.list())
+	}, http.MethodGet))
+	mux.HandleFunc("/jobs/", only(c.apiJob, http.MethodGet))
+	mux.HandleFunc("/", only(c.apiDashboard, http.MethodGet))
+	mux.HandleFunc("/dashboard/state", only(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.dashboardSnapshot())
+	}, http.MethodGet))
+	mux.HandleFunc("/latency", only(c.apiLatency, http.MethodGet))
+	mux.Handle("/metrics", processMetrics)
+	return mux
+}
+
+func (c *ControllerState) apiPeers(w http.ResponseWriter, r *http.Request) {
+	c.lock.RLock()
+	peers := make([]PeerInfo, len(c.PeerList))
+	for i, peer := range c.PeerList {
+		peers[i] = PeerInfo{peer.Address, fmt.Sprintf("%X", peer.GetUUID()), c.maliciousMap[peer.GetUUID()]}
+	}
+	c.lock.RUnlock()
+	writeJSON(w, http.StatusOK, peers)
+}
+
+func (c *ControllerState) apiServers(w http.ResponseWriter, r *http.Request) {
+	c.lock.RLock()
+	servers := append([]string{}, c.ServerList...)
+	c.lock.RUnlock()
+	writeJSON(w, http.StatusOK, servers)
+}
+
+// apiParams shows the parameters, or sets them from an object of names and values, see setParam
+func (c *ControllerState) apiParams(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		values := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// all or nothing
+		params := c.setupParams()
+		for name, value := range values {
+			text := fmt.Sprint(value)
+			if number, ok := value.(float64); ok {
+				text = strconv.FormatFloat(number, 'f', -1, 64)
+			}
+			if err := setParam(&params, name, text); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("%s: %s", name, err))
+				return
+			}
+		}
+		c.setSetupParams(params)
+	}
+	writeJSON(w, http.StatusOK, c.setupParams())
+}
+
+func (c *ControllerState) apiReport(w http.ResponseWriter, r *http.Request) {
+	summary, err := c.summary()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func (c *ControllerState) apiSpawn(w http.ResponseWriter, r *http.Request) {
+	request := SpawnRequest{Count: 1}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.Count <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("count must be positive"))
+		return
+	}
+	if len(c.ServerList) == 0 {
+		writeError(w, http.StatusConflict, fmt.Errorf("no spawner found"))
+		return
+	}
+	if request.Host == "" {
+		go c.spawnEvenly(request.Count)
+	} else {
+		server, ok := c.findServer(request.Host)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no spawner on %s", request.Host))
+			return
+		}
+		c.Spawn(server, request.Count)
+	}
+	writeJSON(w, http.StatusAccepted, request)
+}
+
+// apiNetem shows the fault injection, or sets it from a NetemConfig, an empty one clears it
+func (c *ControllerState) apiNetem(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		config := NetemConfig{}
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := config.validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		c.setNetem(config)
+	}
+	c.lock.RLock()
+	config := c.netem
+	c.lock.RUnlock()
+	writeJSON(w, http.StatusOK, config)
+}
+
+// apiAuto runs an autoTest of ?size= nodes (default 10) with the current parameters
+func (c *ControllerState) apiAuto(w http.ResponseWriter, r *http.Request) {
+	size := 10
+	if arg := r.URL.Query().Get("size"); arg != "" {
+		var err error
+		if size, err = positive(arg); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	c.startJob(w, "auto", func() (interface{}, error) {
+		c.autoTest(size, c.setupParams(), true)
+		run, _ := c.lastRun()
+		return run, nil
+	})
+}
+
+// apiBatch starts a batchTest, or shows the latest one with the runs completed so far
+func (c *ControllerState) apiBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		c.startJob(w, "batch", func() (interface{}, error) {
+			c.batchTest()
+			return nil, nil
+		})
+		return
+	}
+	job, ok := c.jobs.last("batch")
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no batch started"))
+		return
+	}
+	c.lock.RLock()
+	runs := make([]AutoRun, 0)
+	for _, run := range c.autoRuns {
+		if !run.Finished.Before(job.Started) {
+			runs = append(runs, run)
+		}
+	}
+	c.lock.RUnlock()
+	writeJSON(w, http.StatusOK, struct {
+		Job  Job
+		Runs []AutoRun
+	}{job, runs})
+}
+
+func (c *ControllerState) apiJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/jobs/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("not a job id"))
+		return
+	}
+	job, ok := c.jobs.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job %d", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (c *ControllerState) lastRun() (AutoRun, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if len(c.autoRuns) == 0 {
+		return AutoRun{}, false
+	}
+	return c.autoRuns[len(c.autoRuns)-1], true
+}
+
+// serveAPI serves the HTTP API until the controller exits
+func (c *ControllerState) serveAPI(address string) {
+	server := &http.Server{Addr: address, Handler: c.apiHandler()}
+	go func() {
+		fmt.Printf("HTTP API listening at %s\n", address)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP API: %s\n", err)
+		}
+	}()
+}
@@ -0,0 +1,115 @@
+package algorithm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControllerState_apiParams(t *testing.T) {
+	c := ControllerState{SetupParams: DefaultSetupParams}
+	server := httptest.NewServer(c.apiHandler())
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/params", "application/json",
+		strings.NewReader(`{"delta": 0.005, "round": "300ms", "offset": 6}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := ProtocolRPCSetupParams{}
+	json.NewDecoder(response.Body).Decode(&params)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || params.Delta != 0.005 || params.RoundDuration != 300*time.Millisecond || params.Offset != 6 {
+		t.Errorf("params not set: %d %+v", response.StatusCode, params)
+	}
+
+	// an out of range value sets nothing
+	response, err = http.Post(server.URL+"/params", "application/json", strings.NewReader(`{"offset": 2, "f": 0.2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest || c.SetupParams.Offset != 6 {
+		t.Errorf("invalid params accepted: %d, offset %d", response.StatusCode, c.SetupParams.Offset)
+	}
+
+	response, err = http.Post(server.URL+"/peers", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /peers answered %d", response.StatusCode)
+	}
+}
+
+func TestJobRegistry(t *testing.T) {
+	var r jobRegistry
+	release := make(chan bool)
+	job, err := r.start("measure", func() (interface{}, error) {
+		<-release
+		return 42, nil
+	})
+	if err != nil || job.State != JOB_RUNNING {
+		t.Fatalf("job not started: %v %+v", err, job)
+	}
+	// one job at a time
+	if _, err = r.start("setup", func() (interface{}, error) { return nil, nil }); err == nil {
+		t.Errorf("second job started while the first is running")
+	}
+	release <- true
+	for i := 0; i < 100; i++ {
+		if job, _ = r.get(job.Id); job.State != JOB_RUNNING {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.State != JOB_DONE || job.Result != 42 || job.Finished.IsZero() {
+		t.Errorf("job not done: %+v", job)
+	}
+	if last, ok := r.last("measure"); !ok || last.Id != job.Id {
+		t.Errorf("last measure job not found")
+	}
+	if _, ok := r.get(job.Id + 1); ok {
+		t.Errorf("unknown job found")
+	}
+}
+
+func TestDashboardSnapshot_summarize(t *testing.T) {
+	snapshot := DashboardSnapshot{Nodes: []NodeStatus{
+		{Address: "a", Reachable: true, Finished: true, Digest: "AB", MsgCount: 3, ByteCount: 100},
+		{Address: "b", Reachable: true, Finished: true, Digest: "AB", MsgCount: 4, ByteCount: 200},
+		{Address: "c", Reachable: true, Malicious: true, Digest: "CD", MsgCount: 5},
+		{Address: "d"},
+	}}
+	snapshot.summarize()
+	if snapshot.Reachable != 3 || !snapshot.Consensus || !snapshot.Finished || snapshot.MsgCount != 12 || snapshot.ByteCount != 300 {
+		t.Errorf("wrong summary: %+v", snapshot)
+	}
+	snapshot.Nodes[1].Digest = "EF"
+	snapshot.Nodes[1].Finished = false
+	snapshot = DashboardSnapshot{Nodes: snapshot.Nodes}
+	snapshot.summarize()
+	if snapshot.Consensus || snapshot.Finished || snapshot.DistinctViews != 2 {
+		t.Errorf("disagreement not shown: %+v", snapshot)
+	}
+}
+
+func TestControllerState_apiDashboard(t *testing.T) {
+	c := ControllerState{SetupParams: DefaultSetupParams}
+	server := httptest.NewServer(c.apiHandler())
+	defer server.Close()
+	for path, status := range map[string]int{"/": http.StatusOK, "/dashboard/state": http.StatusOK, "/latency": http.StatusNotFound, "/nothing": http.StatusNotFound} {
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != status {
+			t.Errorf("GET %s answered %d", path, response.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	AUTOTUNE_TARGET  = 0.99 // default fraction of messages to land within offset rounds
+	AUTOTUNE_SIZE    = 2000 // the payload size the rounds are tuned for, about a signed Sample message
+	AUTOTUNE_SAMPLES = 20   // signatures timed for the crypto cost
+
+	// the round durations tried, from AUTOTUNE_MIN_ROUND in AUTOTUNE_STEP steps
+	AUTOTUNE_MIN_ROUND = 50 * time.Millisecond
+	AUTOTUNE_MAX_ROUND = 2 * time.Second
+	AUTOTUNE_STEP      = 25 * time.Millisecond
+)
+
+// TuneResult is the parameters picked by autotune, and what they are based on
+type TuneResult struct {
+	RoundDuration  time.Duration
+	Offset         int
+	L              int
+	Latency        time.Duration // latency of the target fraction of messages, crypto included
+	WorstLatency   time.Duration // p99 of the slowest link, crypto included
+	CryptoCost     time.Duration // signing and verifying one message
+	RepetitionTime time.Duration // the estimated duration of a repetition
+}
+
+func (r *TuneResult) String() string {
+	return fmt.Sprintf("RoundDuration: %s, Offset: %d, L: %d (latency %s, worst %s, crypto %s, repetition %s)",
+		r.RoundDuration, r.Offset, r.L, r.Latency, r.WorstLatency, r.CryptoCost, r.RepetitionTime)
+}
+
+// cryptoCost is the median time to sign and to verify a message with a fresh key
+func cryptoCost(samples int) (time.Duration, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return 0, err
+	}
+	costs := make([]time.Duration, samples)
+	for i, _ := range costs {
+		msg := message.Message{Round: i, Type: "Autotune"}
+		msg.Sender = message.Identity{Public_key: x509.MarshalPKCS1PublicKey(&key.PublicKey)}
+		start := time.Now()
+		msg.Sign(key)
+		if err = msg.Verify(); err != nil {
+			return 0, err
+		}
+		costs[i] = time.Since(start)
+	}
+	sort.Slice(costs, func(i, j int) bool { return costs[i] < costs[j] })
+	return percentile(costs, 0.5), nil
+}
+
+// nearestSize is the measured payload size closest to the size
+func nearestSize(sizes []int, size int) int {
+	nearest := -1
+	for _, s := range sizes {
+		if nearest < 0 || math.Abs(float64(s-size)) < math.Abs(float64(nearest-size)) {
+			nearest = s
+		}
+	}
+	return nearest
+}
+
+// tuneRounds picks the round duration, offset and L with the shortest repetition, such that
+// the target fraction of messages land within offset rounds, and the slowest link within L rounds
+func tuneRounds(latency *LatencyMatrix, nodes int, crypto time.Duration, target float64) (TuneResult, error) {
+	size := nearestSize(latency.Sizes(), AUTOTUNE_SIZE)
+	if size < 0 {
+		return TuneResult{}, fmt.Errorf("no latency measured")
+	}
+	result := TuneResult{
+		Latency:      latency.P99(size, target) + crypto,
+		WorstLatency: latency.P99(size, 1) + crypto,
+		CryptoCost:   crypto,
+	}
+	found := false
+	for round := AUTOTUNE_MIN_ROUND; round <= AUTOTUNE_MAX_ROUND; round += AUTOTUNE_STEP {
+		offset := int(math.Ceil(float64(result.Latency) / float64(round)))
+		l := int(math.Ceil(float64(result.WorstLatency) / float64(round)))
+		if offset < 1 {
+			offset = 1
+		}
+		if l < 1 {
+			l = 1
+		}
+		sketch := ProtocolState{l: l, offset: offset}
+		nEstimate := float64(nodes)
+		sketch.x = int(math.Ceil(math.Log(nEstimate)/math.Log(math.Log(nEstimate))+4.0))*l + offset
+		duration := time.Duration(repetitionSketch(&sketch)) * round
+		if !found || duration < result.RepetitionTime {
+			result.RoundDuration, result.Offset, result.L, result.RepetitionTime = round, offset, l, duration
+			found = true
+		}
+	}
+	return result, nil
+}
+
+// autotune measures the network, picks the round parameters, and validates them with one repetition
+func (c *ControllerState) autotune(target float64) {
+	crypto, err := cryptoCost(AUTOTUNE_SAMPLES)
+	if err != nil {
+		fmt.Printf("Autotune: %s\n", err)
+		return
+	}
+	matrix := c.measure(DefaultProbeParams)
+	result, err := tuneRounds(matrix, len(c.PeerList), crypto, target)
+	if err != nil {
+		fmt.Printf("Autotune: %s\n", err)
+		return
+	}
+	fmt.Printf("Autotune: %s\n", result.String())
+
+	params := c.setupParams()
+	params.RoundDuration = result.RoundDuration
+	params.Offset = result.Offset
+	params.L = result.L
+
+	// a short validation run
+	single := params
+	single.Repetitions = 1
+	c.setSetupParams(single)
+	c.SetupProtocol(1, nil)
+	c.StartProtocol(1, nil)
+	validation := ProtocolState{roundDuration: params.RoundDuration, l: params.L, offset: params.Offset, x: c.setupParams().X}
+	time.Sleep(time.Duration(repetitionSketch(&validation)+params.Offset) * params.RoundDuration)
+	states, err := c.gatherStates()
+	c.setSetupParams(params)
+	if err != nil {
+		fmt.Printf("Autotune: validation failed, %s\n", err)
+		return
+	}
+	received, expired := 0, 0
+	for i, _ := range states {
+		received += states[i].MsgReceived
+		expired += states[i].ExpiredMsg
+	}
+	onTime := 1.0
+	if received+expired > 0 {
+		onTime = float64(received) / float64(received+expired)
+	}
+	analysis := c.analysis(states)
+	report, _, _, _ := analysis.Report()
+	fmt.Printf("Autotune: validation %s\nmessages on time: %f (target %f)\nchosen parameters:\n%s",
+		report, onTime, target, params.String())
+}
@@ -0,0 +1,41 @@
+package algorithm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTuneRounds(t *testing.T) {
+	m := NewLatencyMatrix()
+	for i := 0; i < 100; i++ {
+		p99 := 40 * time.Millisecond
+		if i == 99 {
+			// one slow link
+			p99 = 400 * time.Millisecond
+		}
+		m.Links = append(m.Links, LinkStats{Size: 64, Sent: 10, P99: time.Millisecond},
+			LinkStats{Size: 2000, Sent: 10, P99: p99})
+	}
+	result, err := tuneRounds(m, 100, 10*time.Millisecond, 0.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Latency != 50*time.Millisecond || result.WorstLatency != 410*time.Millisecond {
+		t.Errorf("tuned on the wrong latency: %s, worst %s", result.Latency, result.WorstLatency)
+	}
+	// the target fraction lands within offset rounds, the slowest link within L rounds
+	if time.Duration(result.Offset)*result.RoundDuration < result.Latency ||
+		time.Duration(result.L)*result.RoundDuration < result.WorstLatency {
+		t.Errorf("rounds too short: %s", result.String())
+	}
+	if _, err := tuneRounds(NewLatencyMatrix(), 100, 0, 0.9); err == nil {
+		t.Errorf("tuned without latency")
+	}
+}
+
+func TestCryptoCost(t *testing.T) {
+	cost, err := cryptoCost(3)
+	if err != nil || cost <= 0 {
+		t.Errorf("no crypto cost: %s, %s", cost, err)
+	}
+}
@@ -0,0 +1,135 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"crypto/x509"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// the number of times a recovering node tries to listen on its old port
+const RECOVER_LISTEN_TRY = 10
+
+// Checkpoint is the state a node saves at every repetition boundary
+type Checkpoint struct {
+	Key        []byte // PKCS1 private key, the identity of the node
+	Address    string
+	Round      int
+	Repetition int
+	View       message.View
+	InitView   []message.Identity
+	Params     ProtocolRPCSetupParams
+	Saved      time.Time
+}
+
+func checkpointFile(dir string, id *message.Identity) string {
+	return filepath.Join(dir, fmt.Sprintf("%X.ckpt", id.GetUUID()))
+}
+
+// saveCheckpoint writes the checkpoint of the node, the file is replaced at once
+func (p *ProtocolState) saveCheckpoint() error {
+	p.lock.RLock()
+	ckpt := Checkpoint{
+		Key:        x509.MarshalPKCS1PrivateKey(p.privateKey),
+		Address:    p.MyId.Address,
+		Round:      p.Round,
+		Repetition: p.Repetition,
+		View:       p.View,
+		InitView:   make([]message.Identity, len(p.initView)),
+		Params:     p.params,
+		Saved:      time.Now(),
+	}
+	copy(ckpt.InitView, p.initView)
+	p.lock.RUnlock()
+
+	file := checkpointFile(p.checkpointDir, &p.MyId)
+	tmp, err := os.CreateTemp(p.checkpointDir, "ckpt")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(tmp).Encode(&ckpt)
+	if errc := tmp.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func LoadCheckpoint(file string) (*Checkpoint, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ckpt := new(Checkpoint)
+	if err = gob.NewDecoder(f).Decode(ckpt); err != nil {
+		return nil, fmt.Errorf("corrupted checkpoint %s: %s", file, err)
+	}
+	return ckpt, nil
+}
+
+// recoverFrom restores the identity and the state of a checkpoint, listens on the old
+// address, and asks the peers to admit the node at the next repetition boundary
+func (p *ProtocolState) recoverFrom(ckpt *Checkpoint) error {
+	var err error
+	p.privateKey, err = x509.ParsePKCS1PrivateKey(ckpt.Key)
+	if err != nil {
+		return err
+	}
+	// the peers know the node by its address, so it has to come back on the same port
+	port := ckpt.Address[strings.LastIndex(ckpt.Address, ":"):]
+	for i := 0; i < RECOVER_LISTEN_TRY; i++ {
+		if _, err = listenRPC(port, p, p.ExitSignal); err == nil {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %s", port, err)
+	}
+	p.MyId = message.Identity{Address: ckpt.Address, Public_key: x509.MarshalPKCS1PublicKey(&p.privateKey.PublicKey)}
+	p.openEvents()
+	p.openTrace()
+
+	params := ckpt.Params
+	params.InitView = ckpt.InitView
+	p.Setup(params, nil)
+	p.View = ckpt.View
+	p.Repetition = ckpt.Repetition
+
+	peers := make([]message.Identity, 0, JOIN_BOOTSTRAP)
+	for _, i := range rand.Perm(len(ckpt.InitView)) {
+		if len(peers) == JOIN_BOOTSTRAP {
+			break
+		}
+		if ckpt.InitView[i].GetUUID() != p.MyId.GetUUID() {
+			peers = append(peers, ckpt.InitView[i])
+		}
+	}
+	return p.bootstrap(peers, true)
+}
+
+func RecoverNode(controlAddress string, file string, exitSignal chan bool) (*ProtocolState, error) {
+	ckpt, err := LoadCheckpoint(file)
+	if err != nil {
+		return nil, err
+	}
+	p := ProtocolState{}
+	p.ControlAddress = controlAddress
+	p.ExitSignal = exitSignal
+	p.checkpointDir = filepath.Dir(file)
+	if err = p.recoverFrom(ckpt); err != nil {
+		return nil, err
+	}
+	processMetrics.trackNode(&p)
+	fmt.Printf("Node recovered from %s, round %d, repetition %d\n", file, ckpt.Round, ckpt.Repetition)
+	return &p, nil
+}
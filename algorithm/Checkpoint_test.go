@@ -0,0 +1,78 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"bytes"
+	"crypto/x509"
+	"net"
+	"testing"
+)
+
+func TestProtocolState_saveCheckpoint(t *testing.T) {
+	var p ProtocolState
+	p.init()
+	p.checkpointDir = t.TempDir()
+	p.params = DefaultSetupParams
+	p.addToInitView(p.MyId)
+	p.View = message.NewView([]uint64{3, 1, 2})
+	p.Round = 42
+	p.Repetition = 2
+	if err := p.saveCheckpoint(); err != nil {
+		t.Fatalf("unable to save checkpoint: %s", err)
+	}
+	ckpt, err := LoadCheckpoint(checkpointFile(p.checkpointDir, &p.MyId))
+	if err != nil {
+		t.Fatalf("unable to load checkpoint: %s", err)
+	}
+	if ckpt.Round != 42 || ckpt.Repetition != 2 || !ckpt.View.Equal(p.View) || len(ckpt.InitView) != 1 {
+		t.Errorf("wrong checkpoint: %+v", ckpt)
+	}
+	if ckpt.Params.RoundDuration != DefaultSetupParams.RoundDuration {
+		t.Errorf("parameters not saved")
+	}
+	if !bytes.Equal(ckpt.Key, x509.MarshalPKCS1PrivateKey(p.privateKey)) {
+		t.Errorf("key not saved")
+	}
+}
+
+func TestRecoverNode(t *testing.T) {
+	// a running peer to rejoin through
+	var peer, crashed ProtocolState
+	peer.init()
+	crashed.init()
+	peer.Repetition = 5
+
+	// the crashed node comes back on a free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+	crashed.MyId.Address = address
+	crashed.params = DefaultSetupParams
+	crashed.checkpointDir = t.TempDir()
+	crashed.initView = []message.Identity{crashed.MyId, peer.MyId}
+	crashed.View = message.NewView([]uint64{7, 8})
+	crashed.Repetition = 3
+	if err := crashed.saveCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := RecoverNode("", checkpointFile(crashed.checkpointDir, &crashed.MyId), make(chan bool, 5))
+	if err != nil {
+		t.Fatalf("unable to recover: %s", err)
+	}
+	if recovered.MyId.Address != address || !bytes.Equal(recovered.MyId.Public_key, crashed.MyId.Public_key) {
+		t.Errorf("identity not recovered")
+	}
+	if !recovered.View.Equal(crashed.View) {
+		t.Errorf("view not recovered: %v", recovered.View)
+	}
+	if recovered.Repetition != 5+MEMBERSHIP_DELAY {
+		t.Errorf("rejoined at repetition %d", recovered.Repetition)
+	}
+	if _, ok := peer.joiners[crashed.MyId.GetUUID()]; !ok {
+		t.Errorf("recovered node not waiting for admission")
+	}
+}
@@ -0,0 +1,65 @@
+package algorithm
+
+import (
+	"fmt"
+	"time"
+)
+
+// the number of exchanges per node, the one with the smallest round trip is kept
+const CLOCK_PROBES = 5
+
+// ClockSample is the answer of a node to a clock probe, in the clock of the node
+type ClockSample struct {
+	Received time.Time
+	Sent     time.Time
+}
+
+// ClockEstimate is the offset of a node's clock to the controller's, estimated like NTP
+type ClockEstimate struct {
+	Offset time.Duration // node clock minus controller clock
+	RTT    time.Duration // round trip without the processing time at the node
+}
+
+func (p *ProtocolState) ClockProbe(sent time.Time, sample *ClockSample) error {
+	sample.Received = time.Now()
+	sample.Sent = time.Now()
+	return nil
+}
+
+// estimateClock takes the controller's send and receive times t0, t3 and the node's t1, t2
+func estimateClock(t0 time.Time, t1 time.Time, t2 time.Time, t3 time.Time) ClockEstimate {
+	return ClockEstimate{
+		Offset: (t1.Sub(t0) + t2.Sub(t3)) / 2,
+		RTT:    t3.Sub(t0) - t2.Sub(t1),
+	}
+}
+
+// probeClock estimates the clock offset of the node at addr, from the exchange with the smallest round trip
+func probeClock(addr string, timeout time.Duration) (ClockEstimate, error) {
+	var best ClockEstimate
+	found := false
+	for i := 0; i < CLOCK_PROBES; i++ {
+		sample := ClockSample{}
+		// the wall clock is compared with the node's, not the monotonic one
+		t0 := time.Now().Round(0)
+		err := RpcCall(addr, "ProtocolState.ClockProbe", t0, &sample, timeout)
+		t3 := time.Now().Round(0)
+		if err != nil {
+			continue
+		}
+		estimate := estimateClock(t0, sample.Received, sample.Sent, t3)
+		if !found || estimate.RTT < best.RTT {
+			best = estimate
+			found = true
+		}
+	}
+	if !found {
+		return best, fmt.Errorf("no clock probe to %s answered", addr)
+	}
+	return best, nil
+}
+
+// aligned converts a time of the node to the controller's clock
+func (p *ProtocolState) aligned(t time.Time) time.Time {
+	return t.Add(-p.ClockOffset)
+}
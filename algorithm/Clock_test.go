@@ -0,0 +1,45 @@
+package algorithm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateClock(t *testing.T) {
+	// the node is 300ms ahead, 20ms each way, 5ms at the node
+	t0 := time.Now()
+	t1 := t0.Add(20*time.Millisecond + 300*time.Millisecond)
+	t2 := t1.Add(5 * time.Millisecond)
+	t3 := t0.Add(45 * time.Millisecond)
+	estimate := estimateClock(t0, t1, t2, t3)
+	if estimate.Offset != 300*time.Millisecond || estimate.RTT != 40*time.Millisecond {
+		t.Errorf("wrong estimate: offset %s, rtt %s", estimate.Offset, estimate.RTT)
+	}
+}
+
+func TestProbeClock(t *testing.T) {
+	var p ProtocolState
+	p.init()
+	estimate, err := probeClock(p.MyId.Address, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same clock
+	if estimate.Offset > estimate.RTT || -estimate.Offset > estimate.RTT {
+		t.Errorf("offset %s beyond the round trip %s", estimate.Offset, estimate.RTT)
+	}
+}
+
+func TestData_runSpan(t *testing.T) {
+	start := time.Now()
+	states := make([]ProtocolState, 2)
+	// the second node's clock is 1s ahead
+	states[0].StartTime, states[0].FinishTime = start, start.Add(10*time.Second)
+	states[1].ClockOffset = time.Second
+	states[1].StartTime, states[1].FinishTime = start.Add(time.Second+100*time.Millisecond), start.Add(12*time.Second)
+	data := Data{states, DefaultSetupParams, nil}
+	span, spread := data.runSpan()
+	if span != 11*time.Second || spread != 100*time.Millisecond {
+		t.Errorf("wrong span %s, spread %s", span, spread)
+	}
+}
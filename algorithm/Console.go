@@ -0,0 +1,403 @@
+package algorithm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// consoleCommand is a command of the controller console, with its arguments as typed
+type consoleCommand struct {
+	name    string
+	usage   string
+	help    string
+	minArgs int
+	maxArgs int
+	run     func(c *ControllerState, args []string) error
+}
+
+var consoleCommands = []consoleCommand{
+	{"server", "server", "show the number of connected spawners", 0, 0,
+		func(c *ControllerState, args []string) error {
+			fmt.Printf("Connected Servers: %d\n", len(c.ServerList))
+			return nil
+		}},
+	{"peer", "peer", "show the number of registered nodes", 0, 0,
+		func(c *ControllerState, args []string) error {
+			fmt.Printf("Connected Peers: %d\n", len(c.PeerList))
+			return nil
+		}},
+	{"lock", "lock", "show the holder of the controller lock", 0, 0,
+		func(c *ControllerState, args []string) error {
+			fmt.Printf("Lock holder: %s\n", c.lockHolder)
+			return nil
+		}},
+	{"batch", "batch", "automated batch testing, according to the scheme in batchTest", 0, 0,
+		func(c *ControllerState, args []string) error {
+			go c.batchTest()
+			return nil
+		}},
+	{"auto", "auto [N]", "spawn N nodes (default 10), run the protocol with the current parameters and report", 0, 1,
+		func(c *ControllerState, args []string) error {
+			size := 10
+			if len(args) == 1 {
+				var err error
+				if size, err = positive(args[0]); err != nil {
+					return err
+				}
+			}
+			go c.autoTest(size, c.setupParams(), true)
+			return nil
+		}},
+	{"setup", "setup", "set up the nodes with the current parameters", 0, 0,
+		func(c *ControllerState, args []string) error {
+			go c.SetupProtocol(1, nil)
+			return nil
+		}},
+	{"start", "start", "start the view reconciliation on all the nodes simultaneously", 0, 0,
+		func(c *ControllerState, args []string) error {
+			go c.StartProtocol(1, nil)
+			return nil
+		}},
+	{"set", "set NAME VALUE", "change a parameter for the next setup, see params for the names", 2, 2,
+		func(c *ControllerState, args []string) error {
+			params := c.setupParams()
+			if err := setParam(&params, args[0], args[1]); err != nil {
+				return err
+			}
+			c.setSetupParams(params)
+			fmt.Printf("%s set to %s\n", args[0], args[1])
+			return nil
+		}},
+	{"params", "params", "show the parameters of the next setup", 0, 0,
+		func(c *ControllerState, args []string) error {
+			params := c.setupParams()
+			fmt.Printf("%sNames for set: %s\n", params.String(), strings.Join(setupParamNames, " "))
+			return nil
+		}},
+	{"state", "state [ADDR]", "report the state of the node at ADDR, or of a random node", 0, 1,
+		func(c *ControllerState, args []string) error {
+			if len(c.PeerList) == 0 {
+				return fmt.Errorf("peer list is empty")
+			}
+			// pick a random node to retrieve state
+			nodeAddr := c.PeerList[rand.Int()%len(c.PeerList)].Address
+			if len(args) == 1 {
+				nodeAddr = args[0]
+			}
+			go func() {
+				fmt.Printf("%s", c.checkState(nodeAddr))
+			}()
+			return nil
+		}},
+	{"report", "report [--json]", "report the run over all honest nodes, as json with --json", 0, 1,
+		func(c *ControllerState, args []string) error {
+			if len(args) == 1 && args[0] != "--json" {
+				return fmt.Errorf("unknown option %s", args[0])
+			}
+			go func() {
+				if len(args) == 0 {
+					fmt.Printf("%s", c.fullReport())
+					return
+				}
+				summary, err := c.summary()
+				if err != nil {
+					fmt.Printf("Report: %s\n", err)
+					return
+				}
+				data, _ := json.MarshalIndent(summary, "", "  ")
+				fmt.Printf("%s\n", data)
+			}()
+			return nil
+		}},
+	{"history", "history", "collect the per-repetition view history of the honest nodes, and show when their views first agreed", 0, 0,
+		func(c *ControllerState, args []string) error {
+			go func() {
+				fmt.Printf("%s", convergenceString(convergenceTrace(c.gatherHistories())))
+			}()
+			return nil
+		}},
+	{"reset", "reset", "kill all the nodes", 0, 0,
+		func(c *ControllerState, args []string) error {
+			go c.KillNodes(1, nil)
+			return nil
+		}},
+	{"kill", "kill ADDR", "kill the node at ADDR", 1, 1,
+		func(c *ControllerState, args []string) error {
+			if !c.hasPeer(args[0]) {
+				return fmt.Errorf("no node at %s", args[0])
+			}
+			c.killNode(args[0])
+			c.removePeer(args[0])
+			return nil
+		}},
+	{"load", "load", "connect to the default spawners", 0, 0,
+		func(c *ControllerState, args []string) error {
+			go c.load()
+			return nil
+		}},
+	{"spawn", "spawn [N] [on HOST]", "spawn N nodes (default 1), evenly over the spawners or on the spawner at HOST", 0, 3,
+		func(c *ControllerState, args []string) error {
+			count := 1
+			if len(args) == 1 || len(args) == 3 {
+				var err error
+				if count, err = positive(args[0]); err != nil {
+					return err
+				}
+				args = args[1:]
+			}
+			if len(c.ServerList) == 0 {
+				return fmt.Errorf("no spawner found")
+			}
+			if len(args) == 0 {
+				go c.spawnEvenly(count)
+				return nil
+			}
+			if len(args) != 2 || args[0] != "on" {
+				return fmt.Errorf("expected on HOST")
+			}
+			server, ok := c.findServer(args[1])
+			if !ok {
+				return fmt.Errorf("no spawner on %s", args[1])
+			}
+			c.Spawn(server, count)
+			return nil
+		}},
+	{"join", "join N", "spawn N nodes that join the running protocol at the next repetition", 1, 1,
+		func(c *ControllerState, args []string) error {
+			count, err := positive(args[0])
+			if err != nil {
+				return err
+			}
+			go c.join(count)
+			return nil
+		}},
+	{"leave", "leave N", "let N random honest nodes leave the running protocol at the next repetition", 1, 1,
+		func(c *ControllerState, args []string) error {
+			count, err := positive(args[0])
+			if err != nil {
+				return err
+			}
+			go c.leave(count)
+			return nil
+		}},
+	{"measure", "measure [FILE]", "every node probes its peers; show the round trips and keep the latency matrix, written to FILE as csv if given", 0, 1,
+		func(c *ControllerState, args []string) error {
+			go func() {
+				matrix := c.measure(DefaultProbeParams)
+				if len(args) == 1 {
+					if err := writeLatencyFile(matrix, args[0]); err != nil {
+						fmt.Printf("Measure: %s\n", err)
+						return
+					}
+					fmt.Printf("Latency matrix written to %s\n", args[0])
+				}
+			}()
+			return nil
+		}},
+	{"autotune", "autotune [TARGET]", "pick RoundDuration, Offset and L so that TARGET (default 0.99) of the messages land within Offset rounds", 0, 1,
+		func(c *ControllerState, args []string) error {
+			target := AUTOTUNE_TARGET
+			if len(args) == 1 {
+				var err error
+				target, err = strconv.ParseFloat(args[0], 64)
+				if err != nil || target <= 0 || target > 1 {
+					return fmt.Errorf("needs a target fraction in (0, 1]")
+				}
+			}
+			go c.autotune(target)
+			return nil
+		}},
+	{"netem", "netem FILE|off", "set the fault injection of FILE on every node, or clear it", 1, 1,
+		func(c *ControllerState, args []string) error {
+			if args[0] == "off" {
+				go c.setNetem(NetemConfig{})
+				return nil
+			}
+			config, err := LoadNetemConfig(args[0])
+			if err != nil {
+				return err
+			}
+			go c.setNetem(config)
+			return nil
+		}},
+	{"exit", "exit", "kill all the nodes and spawners, and exit", 0, 0,
+		func(c *ControllerState, args []string) error {
+			c.KillNodes(1, nil)
+			c.KillServers(1, nil)
+			c.ExitSignal <- true
+			return nil
+		}},
+}
+
+// console runs a line typed at the console
+func (c *ControllerState) console(text string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return
+	}
+	if fields[0] == "help" {
+		consoleHelp(fields[1:])
+		return
+	}
+	for _, command := range consoleCommands {
+		if command.name != fields[0] {
+			continue
+		}
+		args := fields[1:]
+		if len(args) < command.minArgs || len(args) > command.maxArgs {
+			fmt.Printf("usage: %s\n", command.usage)
+			return
+		}
+		if err := command.run(c, args); err != nil {
+			fmt.Printf("%s: %s\nusage: %s\n", command.name, err, command.usage)
+		}
+		return
+	}
+	fmt.Printf("unknown command %s, try help\n", fields[0])
+}
+
+// consoleHelp lists the commands, or describes the ones named
+func consoleHelp(names []string) {
+	for _, command := range consoleCommands {
+		if len(names) == 0 {
+			fmt.Printf("%-20s %s\n", command.usage, command.help)
+			continue
+		}
+		for _, name := range names {
+			if name == command.name {
+				fmt.Printf("usage: %s\n%s\n", command.usage, command.help)
+			}
+		}
+	}
+}
+
+// setupParamNames are the parameters set and the scenarios can change; x is left out,
+// SetupProtocol derives it from the number of nodes, l and offset
+var setupParamNames = []string{"round", "offset", "f", "g", "l", "delta", "decider", "propose", "accept",
+	"support", "weight", "encoding", "bloom", "gossip", "cells", "fanout", "ttl", "repetitions"}
+
+// setParam sets a setup parameter by its name, within the range the protocol works in
+func setParam(params *ProtocolRPCSetupParams, name string, value string) error {
+	switch name {
+	case "round":
+		d, err := time.ParseDuration(value)
+		if err == nil && d <= 0 {
+			err = fmt.Errorf("round must be positive")
+		}
+		if err == nil {
+			params.RoundDuration = d
+		}
+		return err
+	case "offset":
+		return setInt(&params.Offset, value, 1)
+	case "l":
+		return setInt(&params.L, value, 1)
+	case "cells":
+		return setInt(&params.DeltaCells, value, 1)
+	case "fanout":
+		return setInt(&params.RelayFanout, value, 0)
+	case "ttl":
+		return setInt(&params.RelayTTL, value, 0)
+	case "repetitions":
+		return setInt(&params.Repetitions, value, 0)
+	case "f":
+		return setFloat(&params.F, value, "[0, 0.1)", func(v float64) bool { return v >= 0 && v < 0.1 })
+	case "g":
+		return setFloat(&params.G, value, "[0, 0.01)", func(v float64) bool { return v >= 0 && v < 0.01 })
+	case "delta":
+		return setFloat(&params.Delta, value, "(0, 1)", func(v float64) bool { return v > 0 && v < 1 })
+	case "bloom":
+		return setFloat(&params.BloomFPRate, value, "(0, 1)", func(v float64) bool { return v > 0 && v < 1 })
+	case "propose":
+		return setFloat(&params.ProposeThreshold, value, "(0, 1]", isThreshold)
+	case "accept":
+		return setFloat(&params.AcceptThreshold, value, "(0, 1]", isThreshold)
+	case "support":
+		return setFloat(&params.SupportThreshold, value, "(0, 1]", isThreshold)
+	case "weight":
+		return setFloat(&params.ProposalWeight, value, "(0, 1)", func(v float64) bool { return v > 0 && v < 1 })
+	case "decider":
+		return setChoice(&params.Decider, value, THRESHOLD_DECIDER, MAJORITY_DECIDER)
+	case "encoding":
+		return setChoice(&params.SampleEncoding, value, SAMPLE_ENCODING_FULL, SAMPLE_ENCODING_BLOOM)
+	case "gossip":
+		return setChoice(&params.GossipMode, value, GOSSIP_MODE_FULL, GOSSIP_MODE_DELTA)
+	}
+	return fmt.Errorf("unknown parameter %s", name)
+}
+
+func setInt(dst *int, value string, min int) error {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if i < min {
+		return fmt.Errorf("%d is below %d", i, min)
+	}
+	*dst = i
+	return nil
+}
+
+func setFloat(dst *float64, value string, valid string, inRange func(float64) bool) error {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	if !inRange(v) {
+		return fmt.Errorf("%s is not in %s", value, valid)
+	}
+	*dst = v
+	return nil
+}
+
+// isThreshold leaves out 0, which NewViewDecider takes for a threshold that is not set
+func isThreshold(v float64) bool {
+	return v > 0 && v <= 1
+}
+
+func setChoice(dst *string, value string, choices ...string) error {
+	for _, choice := range choices {
+		if value == choice {
+			*dst = value
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not one of %s", value, strings.Join(choices, ", "))
+}
+
+func writeLatencyFile(matrix *LatencyMatrix, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return matrix.WriteCSV(f)
+}
+
+func (c *ControllerState) hasPeer(addr string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for i, _ := range c.PeerList {
+		if c.PeerList[i].Address == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// findServer finds the spawner by its address, or by its host alone
+func (c *ControllerState) findServer(host string) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, server := range c.ServerList {
+		if server == host || strings.HasPrefix(server, host+":") {
+			return server, true
+		}
+	}
+	return "", false
+}
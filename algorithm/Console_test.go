@@ -0,0 +1,41 @@
+package algorithm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetParam(t *testing.T) {
+	params := DefaultSetupParams
+	steps := [][2]string{
+		{"round", "250ms"}, {"offset", "6"}, {"f", "0.05"}, {"decider", MAJORITY_DECIDER},
+		{"encoding", SAMPLE_ENCODING_BLOOM}, {"fanout", "4"}, {"repetitions", "3"},
+	}
+	for _, step := range steps {
+		if err := setParam(&params, step[0], step[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if params.RoundDuration != 250*time.Millisecond || params.Offset != 6 || params.F != 0.05 ||
+		params.Decider != MAJORITY_DECIDER || params.SampleEncoding != SAMPLE_ENCODING_BLOOM ||
+		params.RelayFanout != 4 || params.Repetitions != 3 {
+		t.Errorf("params set to %+v", params)
+	}
+	invalid := [][2]string{
+		{"gossip", "push"}, {"f", "0.1"}, {"g", "0.01"}, {"g", "-0.001"}, {"delta", "1"},
+		{"offset", "0"}, {"round", "-1s"}, {"accept", "1.5"}, {"fanout", "-1"}, {"rounds", "3"},
+		// the decider would replace these with the defaults
+		{"propose", "0"}, {"support", "0"}, {"weight", "0"}, {"weight", "1"},
+		// x follows from the number of nodes at every setup
+		{"x", "5"},
+	}
+	for _, step := range invalid {
+		if err := setParam(&params, step[0], step[1]); err == nil {
+			t.Errorf("%s %s accepted", step[0], step[1])
+		}
+	}
+	// a rejected value leaves the parameter as it was
+	if params.F != 0.05 || params.Offset != 6 {
+		t.Errorf("rejected value set: %+v", params)
+	}
+}
@@ -15,16 +15,33 @@ import (
 
 // this packet is to monitor and coordinate the nodes
 const MAX_TRY = 10
+// the time the controller gives the Start instructions to reach the nodes
+const START_BARRIER = 2 * time.Second
 var DefaultSetupParams = ProtocolRPCSetupParams{
-	500 * time.Millisecond,
-	4,
-	0.01,
-	0.01,
-	3,
-	2,
-	0.01,
-	message.Identity{},
-	nil,
+	RoundDuration: 500 * time.Millisecond,
+	Offset:        4,
+	F:             0.01,
+	G:             0.01,
+	L:             3,
+	X:             2,
+	Delta:         0.01,
+	Id:            message.Identity{},
+	InitView:      nil,
+
+	Decider:          THRESHOLD_DECIDER,
+	ProposeThreshold: DEFAULT_PROPOSE_THRESHOLD,
+	AcceptThreshold:  DEFAULT_ACCEPT_THRESHOLD,
+	SupportThreshold: DEFAULT_SUPPORT_THRESHOLD,
+	ProposalWeight:   DEFAULT_PROPOSAL_WEIGHT,
+
+	SampleEncoding: SAMPLE_ENCODING_FULL,
+	BloomFPRate:    0.01,
+
+	GossipMode: GOSSIP_MODE_FULL,
+	DeltaCells: DEFAULT_DELTA_CELLS,
+
+	RelayFanout: 0,
+	RelayTTL:    DEFAULT_RELAY_TTL,
 }
 
 type ControllerState struct {
@@ -33,11 +50,19 @@ type ControllerState struct {
 	PeerList      []message.Identity
 	Address       string
 	ServerList    []string
-	NetworkMetric []PingValueReport
+	Latency       *LatencyMatrix // from the last measure
 	lock          sync.RWMutex
 	lockHolder    string // completely for debugging purpose
 	maliciousMap  map[uint64]bool
 	errorCount    map[string]int
+	pendingJoins  int // spawned nodes to bootstrap into the running protocol once they register
+	clocks        map[string]ClockEstimate // clock offsets of the peers, by address, from the last setup
+	netem         NetemConfig              // the fault injection last set on the peers
+	jobs          jobRegistry              // operations started over the HTTP API
+	autoRuns      []AutoRun                // outcomes of the autoTests, latest last
+	dashboard     dashboard                // the snapshot the web dashboard polls
+	collected     *fileSink                // the events the nodes sent to the controller
+	collectLock   sync.Mutex               // guards collected, apart from lock as CollectEvents writes to the file
 }
 
 func (c *ControllerState) checkConnection() {
@@ -145,36 +170,136 @@ func (c *ControllerState) Register(id message.Identity, rtv *int) error {
 	c.maliciousMap[id.GetUUID()] = false
 	c.lockHolder = ""
 	fmt.Printf("New Peer registered at controller: %s\n", id.Address)
+	if c.pendingJoins > 0 {
+		c.pendingJoins--
+		go c.joinNode(id)
+	}
 	return nil
 }
 
+func (c *ControllerState) joinNode(id message.Identity) {
+	// bootstrap a registered node into the running protocol from a few random peers
+	c.lock.RLock()
+	bootstrap := make([]message.Identity, 0, JOIN_BOOTSTRAP)
+	for _, i := range rand.Perm(len(c.PeerList)) {
+		if len(bootstrap) == JOIN_BOOTSTRAP {
+			break
+		}
+		peer := c.PeerList[i]
+		if peer.GetUUID() != id.GetUUID() && !c.maliciousMap[peer.GetUUID()] {
+			bootstrap = append(bootstrap, peer)
+		}
+	}
+	c.lock.RUnlock()
+	params := c.setupParams()
+	instruction := JoinInstruction{params, bootstrap}
+	if estimate, err := probeClock(id.Address, time.Second); err == nil {
+		instruction.Params.ClockOffset = estimate.Offset
+		c.lock.Lock()
+		if c.clocks != nil {
+			c.clocks[id.Address] = estimate
+		}
+		c.lock.Unlock()
+	}
+	err := RpcCall(id.Address, "ProtocolState.Join", instruction, nil,
+		params.RoundDuration*JOIN_BOOTSTRAP+time.Second)
+	if err != nil {
+		fmt.Printf("Join: %s failed to join: %s\n", id.Address, err)
+		c.killNode(id.Address)
+		c.removePeer(id.Address)
+		return
+	}
+	fmt.Printf("Join: %s is joining\n", id.Address)
+}
+
+func (c *ControllerState) removePeer(addr string) {
+	c.lock.Lock()
+	c.lockHolder = "removePeer"
+	defer c.lock.Unlock()
+	for i, _ := range c.PeerList {
+		if c.PeerList[i].Address == addr {
+			c.PeerList = append(c.PeerList[:i], c.PeerList[i+1:]...)
+			break
+		}
+	}
+	c.lockHolder = ""
+}
+
+func (c *ControllerState) join(count int) {
+	// spawn nodes that join the running protocol
+	if len(c.ServerList) == 0 {
+		fmt.Printf("No spawner found.\n", )
+		return
+	}
+	c.lock.Lock()
+	c.pendingJoins += count
+	c.lock.Unlock()
+	c.spawnEvenly(count)
+}
+
+func (c *ControllerState) leave(count int) {
+	// let random honest nodes leave the running protocol
+	c.lock.RLock()
+	leaving := make([]string, 0, count)
+	for _, i := range rand.Perm(len(c.PeerList)) {
+		if len(leaving) == count {
+			break
+		}
+		if !c.maliciousMap[c.PeerList[i].GetUUID()] {
+			leaving = append(leaving, c.PeerList[i].Address)
+		}
+	}
+	c.lock.RUnlock()
+	roundDuration := c.setupParams().RoundDuration
+	for _, addr := range leaving {
+		err := RpcCall(addr, "ProtocolState.Leave", 1, nil, roundDuration)
+		if err != nil {
+			fmt.Printf("Leave: unable to reach %s\n", addr)
+			continue
+		}
+		c.removePeer(addr)
+	}
+	fmt.Printf("Leave: %d nodes leaving\n", len(leaving))
+}
+
 func (c *ControllerState) setupRandomizedView() error {
+	sampleProb := c.SetupParams.ProposeThreshold
+	if sampleProb == 0 {
+		sampleProb = DEFAULT_PROPOSE_THRESHOLD
+	}
 	c.lock.RLock()
 	c.lockHolder = "setupRandomizedView"
 	for i, _ := range c.PeerList {
-		view := make([]uint64, 0)
+		ids := make([]uint64, 0)
 		for j, _ := range c.PeerList {
-			if (rand.Float32() < 0.4) {
-				// 0.4 is the sample probability for leader's proposal
-				view = append(view, c.PeerList[j].GetUUID())
+			if (rand.Float64() < sampleProb) {
+				// the sample probability is the threshold for leader's proposal
+				ids = append(ids, c.PeerList[j].GetUUID())
 			}
 		}
-		go RpcCall(c.PeerList[i].Address, "ProtocolState.SetView", view, nil, time.Second)
+		go RpcCall(c.PeerList[i].Address, "ProtocolState.SetView", message.NewView(ids), nil, time.Second)
 	}
 	c.lock.RUnlock()
 	return nil
 }
 
 func (c *ControllerState) SetupProtocol(ph1 int, ph2 *int) error {
+	c.lock.Lock()
 	c.SetupParams.InitView = c.PeerList
+	c.SetupParams.Session = rand.Uint64() // a fresh session for every setup
 	nEstimate := float64(len(c.PeerList))
 	c.SetupParams.X = int(math.Ceil(math.Log(nEstimate)/math.Log(math.Log(nEstimate))+4.0))*c.SetupParams.L + c.SetupParams.Offset
+	setup := c.SetupParams
+	c.lock.Unlock()
 
+	clocks := c.probeClocks()
 	connectedPeers := make([]message.Identity, 0)
-	for _, peer := range c.PeerList {
-		err := RpcCall(peer.Address, "ProtocolState.Setup", c.SetupParams, nil, time.Second)
+	for _, peer := range setup.InitView {
+		params := setup
+		params.ClockOffset = clocks[peer.Address].Offset
+		err := RpcCall(peer.Address, "ProtocolState.Setup", params, nil, time.Second)
 		if err != nil {
-			RpcCall(peer.Address, "ProtocolState.Exit", c.SetupParams, nil, time.Second)
+			RpcCall(peer.Address, "ProtocolState.Exit", setup, nil, time.Second)
 		} else {
 			connectedPeers = append(connectedPeers, peer)
 		}
@@ -184,10 +309,68 @@ func (c *ControllerState) SetupProtocol(ph1 int, ph2 *int) error {
 	c.PeerList = connectedPeers
 	c.lock.Unlock()
 	c.setupRandomizedView()
-	fmt.Printf(c.SetupParams.String())
+	fmt.Printf(setup.String())
 	return nil
 }
 
+// setupParams is a copy of the parameters of the next setup, which the console, the API and the jobs share
+func (c *ControllerState) setupParams() ProtocolRPCSetupParams {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.SetupParams
+}
+
+func (c *ControllerState) setSetupParams(params ProtocolRPCSetupParams) {
+	c.lock.Lock()
+	c.SetupParams = params
+	c.lock.Unlock()
+}
+
+// probeClocks estimates the clock offsets of all peers, and keeps them for the reports
+func (c *ControllerState) probeClocks() map[string]ClockEstimate {
+	c.lock.RLock()
+	peers := make([]message.Identity, len(c.PeerList))
+	copy(peers, c.PeerList)
+	c.lock.RUnlock()
+	clocks := make(map[string]ClockEstimate)
+	localLock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			estimate, err := probeClock(addr, time.Second)
+			if err != nil {
+				fmt.Printf("Clock: %s\n", err)
+				return
+			}
+			localLock.Lock()
+			clocks[addr] = estimate
+			localLock.Unlock()
+		}(peer.Address)
+	}
+	wg.Wait()
+	var maxOffset, maxRTT time.Duration
+	for _, estimate := range clocks {
+		offset := estimate.Offset
+		if offset < 0 {
+			offset = -offset
+		}
+		if offset > maxOffset {
+			maxOffset = offset
+		}
+		if estimate.RTT > maxRTT {
+			maxRTT = estimate.RTT
+		}
+	}
+	fmt.Printf("Clock: %d of %d peers probed, largest offset %s, largest round trip %s\n",
+		len(clocks), len(peers), maxOffset, maxRTT)
+	c.lock.Lock()
+	c.clocks = clocks
+	c.lock.Unlock()
+	return clocks
+}
+
 func (c *ControllerState) killNode(addr string) {
 	RpcCall(addr, "ProtocolState.Exit", 1, nil, time.Second)
 }
@@ -213,14 +396,16 @@ func (c *ControllerState) KillServers(ph1 int, ph2 *int) error {
 }
 
 func (c *ControllerState) StartProtocol(ph1 int, ph2 *int) error {
+	// all nodes start at the same time, once every node has been told
+	c.SetupParams.StartAt = time.Now().Add(START_BARRIER)
 	c.lock.RLock()
 	c.lockHolder = "StartProtocol"
 	for i, _ := range c.PeerList {
-		go RpcCall(c.PeerList[i].Address, "ProtocolState.Start", 1, nil, c.SetupParams.RoundDuration)
+		go RpcCall(c.PeerList[i].Address, "ProtocolState.StartAt", c.SetupParams.StartAt, nil, c.SetupParams.RoundDuration)
 	}
 	c.lock.RUnlock()
 
-	time.Sleep(c.SetupParams.RoundDuration * time.Duration(c.SetupParams.Offset))
+	time.Sleep(time.Until(c.SetupParams.StartAt) + c.SetupParams.RoundDuration * time.Duration(c.SetupParams.Offset))
 	startedPeers := make([]message.Identity, 0)
 	localLock := sync.Mutex{}
 	for _, peer := range c.PeerList {
@@ -257,60 +442,67 @@ func (c *ControllerState) checkState(address string) string {
 	return state.String()
 }
 
-func (c *ControllerState) AcceptReport(report PingValueReport, ph2 *int) error {
+func (c *ControllerState) measure(params ProbeParams) *LatencyMatrix {
+	// every node probes its peers, the reports form the all-pairs latency matrix
+	c.lock.RLock()
+	c.lockHolder = "measure"
+	peers := make([]string, 0, len(c.PeerList))
+	for _, peer := range c.PeerList {
+		peers = append(peers, peer.Address)
+	}
+	c.lock.RUnlock()
+
+	matrix := NewLatencyMatrix()
+	localLock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	replied := 0
+	for _, addr := range peers {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			report := ProbeReport{}
+			err := RpcCall(addr, "ProtocolState.Probe", params, &report, c.SetupParams.RoundDuration)
+			if err != nil {
+				fmt.Printf("Measure: unable to probe from %s: %s\n", addr, err)
+				return
+			}
+			localLock.Lock()
+			matrix.Add(report)
+			replied++
+			localLock.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+
 	c.lock.Lock()
-	c.lockHolder = "AcceptReport"
-	c.NetworkMetric = append(c.NetworkMetric, report)
+	c.Latency = matrix
 	c.lock.Unlock()
-	return nil
+	fmt.Printf("Out of %d peers, %d replied\n%s", len(peers), replied, matrix.String())
+	return matrix
 }
 
-func (c *ControllerState) measure() {
-	c.NetworkMetric = make([]PingValueReport, 0)
+// setNetem sends the fault injection to all peers
+func (c *ControllerState) setNetem(config NetemConfig) {
+	c.lock.Lock()
+	c.netem = config
+	c.lock.Unlock()
 	c.lock.RLock()
-	c.lockHolder = "measure"
+	peers := make([]string, 0, len(c.PeerList))
 	for _, peer := range c.PeerList {
-		go RpcCall(peer.Address, "ProtocolState.PingReport", 2000, nil, c.SetupParams.RoundDuration)
+		peers = append(peers, peer.Address)
 	}
 	c.lock.RUnlock()
-
-	time.Sleep(6 * c.SetupParams.RoundDuration)
-
-	// process
-	peerCount := len(c.PeerList)
-	reportCount := len(c.NetworkMetric)
-	connectionCount := 0
-	failCount := 0
-	totalDelay := float64(0)
-	for i, _ := range c.NetworkMetric {
-		for _, delay := range c.NetworkMetric[i] {
-			if delay <= 0 {
-				failCount++
-			} else {
-				connectionCount++
-				totalDelay += float64(delay) / 1000000.0
-			}
+	failed := 0
+	for _, addr := range peers {
+		if err := RpcCall(addr, "ProtocolState.SetNetem", config, nil, time.Second); err != nil {
+			fmt.Printf("Netem: %s: %s\n", addr, err)
+			failed++
 		}
 	}
-	var avgDelay float64
-	if connectionCount == 0 {
-		avgDelay = -1
-	} else {
-		avgDelay = totalDelay / float64(connectionCount)
-	}
-	fmt.Printf("Out of %d peers, %d replied, with %d failed measures, the average delay is %f\n",
-		peerCount,
-		reportCount,
-		failCount,
-		avgDelay)
+	fmt.Printf("Netem: set on %d of %d peers\n", len(peers)-failed, len(peers))
 }
 
-func (c *ControllerState) report() (report string, fin bool, cons bool, round int) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("Panic Catched in report %s\n", r)
-		}
-	}()
+func (c *ControllerState) gatherStates() ([]ProtocolState, error) {
 	log.Printf("Gathering Report...\n", )
 	statelen := 0
 	stateChan := make(chan *ProtocolState)
@@ -355,15 +547,120 @@ func (c *ControllerState) report() (report string, fin bool, cons bool, round in
 		if s != nil {
 			state[i] = *s
 		} else {
-			return "false, some nodes did not reply\n", false, false, -1
+			return nil, fmt.Errorf("some nodes did not reply")
+		}
+	}
+	return state, nil
+}
+
+func (c *ControllerState) report() (report string, fin bool, cons bool, round int) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("Panic Catched in report %s\n", r)
 		}
+	}()
+	state, err := c.gatherStates()
+	if err != nil {
+		return "false, " + err.Error() + "\n", false, false, -1
 	}
 	log.Printf("Analyzing Report...\n", )
-	analysis := Data{state, c.SetupParams}
+	analysis := c.analysis(state)
 	return analysis.Report()
 }
 
-func (c *ControllerState) StartListen() {
+func (c *ControllerState) fullReport() string {
+	// the report line followed by the statistics of the elections
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("Panic Catched in report %s\n", r)
+		}
+	}()
+	state, err := c.gatherStates()
+	if err != nil {
+		return "false, " + err.Error() + "\n"
+	}
+	analysis := c.analysis(state)
+	report, _, _, _ := analysis.Report()
+	sample := analysis.sampleStats()
+	gossip := analysis.gossipStats()
+	return report + "\n" + analysis.consensusStats().String() + analysis.electionStats().String() + "Sample: " + sample.String() + "\n" +
+		"Gossip: " + gossip.String() + "\n" +
+		"Proposal reach per repetition: " + reachString(analysis.proposalReach()) + "\n" +
+		fmt.Sprintf("Messages dropped by netem: %d\n", analysis.netemDropped()) +
+		analysis.spanString()
+}
+
+// analysis is the report of the gathered states, with the nodes the controller knows to be malicious
+func (c *ControllerState) analysis(states []ProtocolState) Data {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	malicious := make(map[uint64]bool)
+	for id, known := range c.maliciousMap {
+		if known {
+			malicious[id] = true
+		}
+	}
+	return Data{states, c.SetupParams, malicious}
+}
+
+// summary is the report of the honest nodes, for report --json
+func (c *ControllerState) summary() (Summary, error) {
+	state, err := c.gatherStates()
+	if err != nil {
+		return Summary{}, err
+	}
+	analysis := c.analysis(state)
+	return analysis.Summary(), nil
+}
+
+func (c *ControllerState) gatherHistories() [][]RepetitionRecord {
+	c.lock.RLock()
+	peers := make([]message.Identity, 0, len(c.PeerList))
+	for _, peer := range c.PeerList {
+		if !c.maliciousMap[peer.GetUUID()] {
+			peers = append(peers, peer)
+		}
+	}
+	c.lock.RUnlock()
+
+	historyChan := make(chan []RepetitionRecord, len(peers))
+	for _, peer := range peers {
+		go func(addr string) {
+			history := make([]RepetitionRecord, 0)
+			err := RpcCall(addr, "ProtocolState.RetrieveHistory", 1, &history, c.SetupParams.RoundDuration*time.Duration(c.SetupParams.L))
+			if err != nil {
+				fmt.Printf("History: Unable to connect to %s\n", addr)
+				historyChan <- nil
+				return
+			}
+			historyChan <- history
+		}(peer.Address)
+	}
+	histories := make([][]RepetitionRecord, 0, len(peers))
+	for range peers {
+		if history := <-historyChan; history != nil {
+			histories = append(histories, history)
+		}
+	}
+	return histories
+}
+
+// collectMetrics sets the gauges of the controller
+func (c *ControllerState) collectMetrics(m *Metrics) {
+	c.lock.RLock()
+	peers, servers := len(c.PeerList), len(c.ServerList)
+	c.lock.RUnlock()
+	m.Set("rvr_controller_peers", "registered nodes", "", float64(peers))
+	m.Set("rvr_controller_servers", "connected spawners", "", float64(servers))
+	running := 0.0
+	if job, ok := c.jobs.latest(); ok && job.State == JOB_RUNNING {
+		running = 1
+	}
+	m.Set("rvr_controller_job_running", "1 while a job started over the API runs", "", running)
+}
+
+// listen starts the rpc server the nodes register at
+func (c *ControllerState) listen() {
 	c.PeerList = make([]message.Identity, 0)
 	c.maliciousMap = make(map[uint64]bool)
 	c.errorCount = make(map[string] int)
@@ -372,6 +669,7 @@ func (c *ControllerState) StartListen() {
 	myIP := GetOutboundAddr()
 	c.Address = myIP + myPort
 	fmt.Printf("Controller started at Address: %s\n", c.Address)
+	processMetrics.Collect(c.collectMetrics)
 
 	// setup watchdog
 	go func() {
@@ -380,66 +678,14 @@ func (c *ControllerState) StartListen() {
 			c.checkConnection()
 		}
 	}()
+}
 
+func (c *ControllerState) StartListen() {
+	c.listen()
 	for {
 		scanner := bufio.NewScanner(os.Stdin)
 		for scanner.Scan() {
-			text := scanner.Text()
-			switch text {
-			case "server":
-				fmt.Printf("Connected Servers: %d\n", len(c.ServerList))
-			case "peer":
-				fmt.Printf("Connected Peers: %d\n", len(c.PeerList))
-			case "batch":
-				go c.batchTest()
-			case "auto":
-				go c.autoTest(10, DefaultSetupParams, true)
-			case "setup":
-				go c.SetupProtocol(1, nil)
-			case "start":
-				go c.StartProtocol(1, nil)
-			case "state":
-				go func() {
-					if len(c.PeerList) == 0 {
-						fmt.Printf("Peer list is empty\n", )
-					} else {
-						// pick a random node to retrieve state
-						nodeAddr := c.PeerList[rand.Int()%len(c.PeerList)].Address
-						fmt.Printf(c.checkState(nodeAddr))
-					}
-				}()
-			case "lock":
-				fmt.Printf("Lock holder: %s\n", c.lockHolder)
-			case "measure":
-				go c.measure()
-			case "report":
-				// pick a random node to retrieve state
-				go func() {
-					report, _, _, _ := c.report()
-					fmt.Printf("%s\n", report)
-				}()
-			case "reset":
-				go func() {
-					c.KillNodes(1, nil)
-				}()
-			case "load":
-				go func() {
-					c.load()
-				}()
-			case "spawn":
-				if len(c.ServerList) == 0 {
-					fmt.Printf("No spawner found.\n", )
-				} else {
-					serverAddr := c.ServerList[rand.Int()%len(c.ServerList)]
-					c.Spawn(serverAddr, 1)
-				}
-			case "exit":
-				c.KillNodes(1, nil)
-				c.KillServers(1, nil)
-				c.ExitSignal <- true
-			default:
-				fmt.Printf("try setup/start instead of %s\n", text)
-			}
+			c.console(scanner.Text())
 		}
 	}
 }
@@ -463,7 +709,7 @@ func (c *ControllerState) autoTest(size int, params ProtocolRPCSetupParams, stop
 		time.Sleep(10 * time.Second)
 	}
 
-	c.SetupParams = params
+	c.setSetupParams(params)
 	fmt.Printf("Auto test: setting up protocol\n", )
 	c.SetupProtocol(1, nil)
 
@@ -533,6 +779,13 @@ func (c *ControllerState) autoTest(size int, params ProtocolRPCSetupParams, stop
 	}
 
 	fmt.Printf("%d,%d, %d, %s, %d, %d\n", len(c.PeerList), maliciousCount, len(c.ServerList), report, consensusTime, consensusRound)
+	c.lock.Lock()
+	c.autoRuns = append(c.autoRuns, AutoRun{size, consensusReached, consensusTime, consensusRound, report, time.Now()})
+	c.lock.Unlock()
+	fmt.Printf("%s", c.fullReport())
+	if err := c.saveRun(consensusTime, consensusRound); err != nil {
+		fmt.Printf("Unable to save the run: %s\n", err)
+	}
 	c.KillNodes(1, nil)
 	return consensusReached
 }
@@ -544,6 +797,9 @@ func (c *ControllerState) batchTest() {
 	fList := []float64{0.05, 0.1}
 	gList := []float64{0.005, 0.01, 0.0025}
 	offsetList := []int{2, 4, 6, 8}
+	bloomRateList := []float64{0.001, 0.01, 0.05}
+	relayFanoutList := []int{3, 5, 8}
+	thresholdList := [][3]float64{{0.4, 0.65, 0.16}, {0.4, 0.6, 0.2}, {0.5, 0.7, 0.2}, {0.3, 0.6, 0.1}} // propose, accept, support
 
 	//for _, size := range sizeList {
 	//	for _, dur := range durationList {
@@ -594,12 +850,49 @@ func (c *ControllerState) batchTest() {
 			c.SetupParams.G = g
 			c.autoTest(80, c.SetupParams, false)
 		}
+		c.SetupParams = DefaultSetupParams
+		for _, thresholds := range thresholdList {
+			c.SetupParams.ProposeThreshold = thresholds[0]
+			c.SetupParams.AcceptThreshold = thresholds[1]
+			c.SetupParams.SupportThreshold = thresholds[2]
+			c.autoTest(80, c.SetupParams, false)
+		}
+		c.SetupParams = DefaultSetupParams
+		c.SetupParams.SampleEncoding = SAMPLE_ENCODING_BLOOM
+		for _, rate := range bloomRateList {
+			c.SetupParams.BloomFPRate = rate
+			c.autoTest(80, c.SetupParams, false)
+		}
+		c.SetupParams = DefaultSetupParams
+		c.SetupParams.GossipMode = GOSSIP_MODE_DELTA
+		for _, size := range sizeList {
+			c.autoTest(size, c.SetupParams, false)
+		}
+		c.SetupParams = DefaultSetupParams
+		for _, fanout := range relayFanoutList {
+			c.SetupParams.RelayFanout = fanout
+			c.autoTest(80, c.SetupParams, false)
+		}
+		c.SetupParams = DefaultSetupParams
+		c.SetupParams.Decider = MAJORITY_DECIDER
+		for _, f := range fList {
+			c.SetupParams.F = f
+			c.autoTest(80, c.SetupParams, false)
+		}
 	}
 }
 
 func StartServer(exitSignal chan bool) {
+	StartServerWithAPI("", exitSignal)
+}
+
+// StartServerWithAPI also serves the HTTP API at apiAddress, unless it is empty
+func StartServerWithAPI(apiAddress string, exitSignal chan bool) {
 	c := ControllerState{}
 	c.ExitSignal = exitSignal
 	c.SetupParams = DefaultSetupParams
+	if apiAddress != "" {
+		c.serveAPI(apiAddress)
+	}
 	go c.StartListen()
 }
@@ -1,25 +1,21 @@
 package algorithm
 
 import (
-	"RVR/message"
 	"fmt"
 	"log"
 	"net"
-	"net/rpc"
 	"testing"
 	"time"
 )
 
-var testSetupParams = ProtocolRPCSetupParams{
-	100 * time.Millisecond,
-	2,
-	0.01,
-	0.01,
-	2,
-	2,
-	0.01,
-	message.Identity{},
-	nil,
+// testSetupParams are the defaults, with short rounds and a single repetition
+func testSetupParams() ProtocolRPCSetupParams {
+	params := DefaultSetupParams
+	params.RoundDuration = 100 * time.Millisecond
+	params.Offset = 2
+	params.L = 2
+	params.Repetitions = 1
+	return params
 }
 
 func Test_getLocalAddress(t *testing.T){
@@ -63,17 +59,15 @@ func Test_Controller(t *testing.T) {
 	}
 
 	// start the controller
-	controller := ControllerState{testSetupParams, make([]message.Identity, 0), ""}
-	controller.StartListen()
-	CONTROL_ADDRESS = controller.Address
-
-	// Dial the controller
-	client, _ := rpc.Dial("tcp", CONTROL_ADDRESS)
+	controller := ControllerState{SetupParams: testSetupParams(), ExitSignal: make(chan bool, 4)}
+	controller.listen()
 
 	// start the nodes
 	syncLock := make(chan bool)
 	peers := make([] ProtocolState, TEST_SIZE)
 	for i, _ := range peers {
+		peers[i].ControlAddress = controller.Address
+		peers[i].ExitSignal = make(chan bool, 4)
 		go func(i int) {
 			peers[i].GetReady()
 			syncLock <- true
@@ -87,16 +81,22 @@ func Test_Controller(t *testing.T) {
 	fmt.Printf("Controller received %d registrations.\n", len(controller.PeerList))
 
 	// controller setup the protocol
-	client.Go("ControllerState.SetupProtocol",1, nil, nil)
-	time.Sleep(500 * time.Millisecond)
+	// the controller serves a request per connection
+	if err := RpcCall(controller.Address, "ControllerState.SetupProtocol", 1, nil, time.Minute); err != nil {
+		t.Fatal(err)
+	}
 
 	// controller start the protocol
-	client.Go("ControllerState.StartProtocol",1, nil, nil)
+	go RpcCall(controller.Address, "ControllerState.StartProtocol", 1, nil, time.Minute)
 
 	// wait until Finished
+	deadline := time.Now().Add(2 * time.Minute)
 	for flag:=true; flag; {
 		flag = false
 		time.Sleep(1 * time.Second)
+		if time.Now().After(deadline) {
+			t.Fatal("the nodes did not finish")
+		}
 		for i, _ := range peers {
 			if !peers[i].Finished {
 				flag = true
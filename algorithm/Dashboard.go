@@ -0,0 +1,168 @@
+package algorithm
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// a dashboard snapshot younger than this is served again instead of polling the nodes
+const DASHBOARD_POLL = 2 * time.Second
+
+//go:embed dashboard/index.html
+var dashboardPage []byte
+
+// NodeStatus is a cell of the dashboard grid
+type NodeStatus struct {
+	Address      string
+	Reachable    bool
+	Round        int
+	Repetition   int
+	CurrentProto string
+	Finished     bool
+	Malicious    bool
+	Digest       string // the first bytes of the view digest, in hex
+	ViewSize     int
+	MsgCount     int
+	ByteCount    int
+	MsgReceived  int
+	Duration     time.Duration // from its start to its finish, once finished
+}
+
+// DashboardSnapshot is the state of the run the dashboard polls
+type DashboardSnapshot struct {
+	Taken         time.Time
+	Nodes         []NodeStatus
+	Reachable     int
+	Finished      bool // every reachable honest node finished
+	Consensus     bool // every reachable honest node holds the same view
+	DistinctViews int
+	MsgCount      int
+	ByteCount     int
+	Job           *Job     `json:",omitempty"` // the latest job started over the API
+	LastRun       *AutoRun `json:",omitempty"`
+}
+
+// dashboard caches the latest snapshot, so that many viewers poll the nodes once
+type dashboard struct {
+	lock     sync.Mutex
+	snapshot DashboardSnapshot
+}
+
+func nodeStatus(addr string, state *ProtocolState) NodeStatus {
+	if state == nil {
+		return NodeStatus{Address: addr}
+	}
+	digest := state.View.Digest()
+	if len(digest) > 6 {
+		digest = digest[:6]
+	}
+	status := NodeStatus{
+		Address:      addr,
+		Reachable:    true,
+		Round:        state.Round,
+		Repetition:   state.Repetition,
+		CurrentProto: state.CurrentProto,
+		Finished:     state.Finished,
+		Malicious:    state.Malicious,
+		Digest:       fmt.Sprintf("%X", digest),
+		ViewSize:     len(state.View),
+		MsgCount:     state.MsgCount,
+		ByteCount:    state.ByteCount,
+		MsgReceived:  state.MsgReceived,
+	}
+	if state.Finished {
+		status.Duration = state.FinishTime.Sub(state.StartTime)
+	}
+	return status
+}
+
+// summarize fills in the totals of the snapshot from its nodes
+func (s *DashboardSnapshot) summarize() {
+	digests := make(map[string]bool)
+	s.Finished = true
+	for _, node := range s.Nodes {
+		if !node.Reachable {
+			continue
+		}
+		s.Reachable++
+		s.MsgCount += node.MsgCount
+		s.ByteCount += node.ByteCount
+		if node.Malicious {
+			continue
+		}
+		digests[node.Digest] = true
+		s.Finished = s.Finished && node.Finished
+	}
+	s.DistinctViews = len(digests)
+	s.Consensus = len(digests) <= 1
+}
+
+// pollNodes retrieves the state of every peer, an unreachable peer is kept in the grid
+func (c *ControllerState) pollNodes() DashboardSnapshot {
+	c.lock.RLock()
+	peers := make([]string, len(c.PeerList))
+	for i, _ := range c.PeerList {
+		peers[i] = c.PeerList[i].Address
+	}
+	c.lock.RUnlock()
+
+	snapshot := DashboardSnapshot{Taken: time.Now(), Nodes: make([]NodeStatus, len(peers))}
+	wg := sync.WaitGroup{}
+	for i, addr := range peers {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			state := ProtocolState{}
+			if err := RpcCall(addr, "ProtocolState.RetrieveState", 1, &state, c.SetupParams.RoundDuration); err != nil {
+				snapshot.Nodes[i] = nodeStatus(addr, nil)
+				return
+			}
+			snapshot.Nodes[i] = nodeStatus(addr, &state)
+		}(i, addr)
+	}
+	wg.Wait()
+	sort.Slice(snapshot.Nodes, func(i, j int) bool { return snapshot.Nodes[i].Address < snapshot.Nodes[j].Address })
+	snapshot.summarize()
+	return snapshot
+}
+
+// dashboardSnapshot polls the nodes, unless the last snapshot is recent enough
+func (c *ControllerState) dashboardSnapshot() DashboardSnapshot {
+	c.dashboard.lock.Lock()
+	defer c.dashboard.lock.Unlock()
+	if time.Since(c.dashboard.snapshot.Taken) >= DASHBOARD_POLL {
+		c.dashboard.snapshot = c.pollNodes()
+	}
+	snapshot := c.dashboard.snapshot
+	if job, ok := c.jobs.latest(); ok {
+		snapshot.Job = &job
+	}
+	if run, ok := c.lastRun(); ok {
+		snapshot.LastRun = &run
+	}
+	return snapshot
+}
+
+func (c *ControllerState) apiDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such page %s", r.URL.Path))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+func (c *ControllerState) apiLatency(w http.ResponseWriter, r *http.Request) {
+	c.lock.RLock()
+	matrix := c.Latency
+	c.lock.RUnlock()
+	if matrix == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("not measured yet, POST /measure"))
+		return
+	}
+	writeJSON(w, http.StatusOK, matrix)
+}
@@ -138,6 +138,29 @@ type ElectionState struct {
 	myNonce        []byte
 	difficulty     float64 // proportion of hash to maxHash
 	m              int // number of hashes per rounds
+	record         ElectionRecord
+}
+
+// ElectionRecord keeps the outcome of one leader election, as seen by this node
+type ElectionRecord struct {
+	Repetition     int
+	Round          int           // the round at which the election finished
+	Leader         uint64        // UUID of the accepted leader, 0 if none
+	LeaderAddress  string
+	Succeeded      bool          // whether a leader is accepted
+	ValidSolutions int           // number of valid solutions received
+	Solved         bool          // whether this node solved the puzzle itself
+	HashAttempts   int           // number of hashes tried while solving
+	EvalTime       time.Duration // time used to evaluate the received solutions
+}
+
+func (r *ElectionRecord) String() string {
+	if !r.Succeeded {
+		return fmt.Sprintf("repetition %d: no leader, solved: %t, hash attempts: %d",
+			r.Repetition, r.Solved, r.HashAttempts)
+	}
+	return fmt.Sprintf("repetition %d: leader %X @ %s, valid solutions: %d, solved: %t, hash attempts: %d, evaluation: %s",
+		r.Repetition, r.Leader, r.LeaderAddress, r.ValidSolutions, r.Solved, r.HashAttempts, r.EvalTime)
 }
 
 func electionSketch(p *ProtocolState, m int) (round int) {
@@ -151,13 +174,25 @@ func electionSketch(p *ProtocolState, m int) (round int) {
 }
 
 func DoElection(protocol *ProtocolState, m int) message.Identity {
-	es := ElectionState{protocol, nil, 0, m}
-	return es.DoElection()
+	leader, _ := doElectionWithRecord(protocol, m)
+	return leader
+}
+
+func doElectionWithRecord(protocol *ProtocolState, m int) (message.Identity, ElectionRecord) {
+	es := ElectionState{protocol, nil, 0, m, ElectionRecord{}}
+	leader := es.DoElection()
+	es.record.Round = protocol.Round
+	if leader.Public_key != nil {
+		es.record.Succeeded = true
+		es.record.Leader = leader.GetUUID()
+		es.record.LeaderAddress = leader.Address
+	}
+	return leader, es.record
 }
 
 func (state *ElectionState) DoElection() message.Identity {
 	p := state.parentProtocol
-	<- p.ticker
+	p.tick()
 	p.lock.Lock()
 	p.Round++
 	p.lock.Unlock()
@@ -176,7 +211,7 @@ func (state *ElectionState) DoElection() message.Identity {
 	msg.Nonce = state.myNonce
 	msg.Type = "Election Challenge"
 	for i := 0; i < p.l; i++ {
-		<-p.ticker
+		p.tick()
 
 		p.lock.Lock()
 		p.Round++
@@ -198,7 +233,7 @@ func (state *ElectionState) DoElection() message.Identity {
 	mTree.addNonce(p.MyId, state.myNonce)
 
 	for i := 0; i < p.offset; i++ {
-		<-p.ticker
+		p.tick()
 		p.lock.Lock()
 		p.Round++
 		p.lock.Unlock()
@@ -210,6 +245,7 @@ func (state *ElectionState) DoElection() message.Identity {
 		if _, ok := p.idToAddrMap[m.Sender.GetUUID()]; ok {
 			if m.Nonce != nil {
 				mTree.addNonce(m.Sender, m.Nonce)
+				p.traceReceive(&m, TRACE_COUNTED)
 			}
 		} else {
 			// message not from initview, abort
@@ -225,6 +261,7 @@ func (state *ElectionState) DoElection() message.Identity {
 	defer close(stopCall)
 	var header []byte
 	ifSolved := false
+	attempts := 0
 	go func() {
 		if (len(mTree.leaveList) == 0) {
 			return
@@ -238,6 +275,7 @@ func (state *ElectionState) DoElection() message.Identity {
 				return
 			default:
 				rand.Read(header)
+				attempts++
 				if evalHashWithDifficulty(header, data, solDifficulty) {
 					leader = p.MyId
 					ifSolved = true
@@ -249,17 +287,19 @@ func (state *ElectionState) DoElection() message.Identity {
 		<-stopCall
 	}()
 	for i := 0; i < 6*(p.offset+p.l); i++ {
-		<-p.ticker
+		p.tick()
 		p.lock.Lock()
 		p.Round++
 		p.lock.Unlock()
 	}
 	stopCall <- true
+	state.record.Solved = ifSolved
+	state.record.HashAttempts = attempts
 
 	if ifSolved {
 		// disseminate the solution for l rounds
 		for i := 0; i < p.l; i++ {
-			<-p.ticker
+			p.tick()
 			p.lock.Lock()
 			p.Round++
 			p.lock.Unlock()
@@ -284,7 +324,7 @@ func (state *ElectionState) DoElection() message.Identity {
 	} else {
 		// wait for l rounds
 		for i := 0; i < p.l; i++ {
-			<-p.ticker
+			p.tick()
 			p.lock.Lock()
 			p.Round++
 			p.lock.Unlock()
@@ -293,7 +333,7 @@ func (state *ElectionState) DoElection() message.Identity {
 
 	// line 10: receive solutions for offset rounds
 	for i := 0; i < p.offset; i++ {
-		<-p.ticker
+		p.tick()
 		p.lock.Lock()
 		p.Round++
 		p.lock.Unlock()
@@ -312,15 +352,16 @@ func (state *ElectionState) DoElection() message.Identity {
 			treeHash := EvalSol(m.Proof, m.Order)
 			if evalHashWithDifficulty(m.Nonce, treeHash, state.difficulty) {
 				leader = m.Sender
+				state.record.ValidSolutions++
+				p.traceReceive(&m, TRACE_COUNTED)
 			}else{
-				//
+				p.traceReceive(&m, TRACE_INVALID)
 			}
 		} else {
 			// message not from initview, ignore
 		}
 	}
-	timeFin := time.Now()
-	fmt.Printf("%d used for leader evaluation\n", timeFin.Sub(startTime))
+	state.record.EvalTime = time.Since(startTime)
 	p.inQueue = make([]message.Message, 0)
 	p.lock.Unlock()
 	return leader
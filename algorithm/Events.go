@@ -0,0 +1,339 @@
+package algorithm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	LEVEL_DEBUG = "debug"
+	LEVEL_INFO  = "info"
+	LEVEL_WARN  = "warn"
+	LEVEL_ERROR = "error"
+)
+
+var levelRank = map[string]int{LEVEL_DEBUG: 0, LEVEL_INFO: 1, LEVEL_WARN: 2, LEVEL_ERROR: 3}
+
+// EVENTS_TO_CONTROLLER as the event target sends the events to the controller, which collects them
+const EVENTS_TO_CONTROLLER = "controller"
+
+// the collector sends its batch when it holds this many events, or every EVENT_FLUSH
+const EVENT_BATCH = 256
+const EVENT_FLUSH = time.Second
+
+// events waiting for the collector beyond this are dropped, the protocol does not wait for the log
+const EVENT_BUFFER = 4096
+
+// Event is a line of the structured event log
+type Event struct {
+	Time       time.Time              `json:"time"`
+	Level      string                 `json:"level"`
+	Node       string                 `json:"node"` // the UUID of the node, in hex
+	Address    string                 `json:"address"`
+	Session    uint64                 `json:"session"`
+	Round      int                    `json:"round"`
+	Repetition int                    `json:"repetition"`
+	Phase      string                 `json:"phase"`
+	Name       string                 `json:"event"` // what happened, like "election_failed"
+	Message    string                 `json:"msg"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+}
+
+// eventSink is where a node writes its events; the events written after close are lost
+type eventSink interface {
+	write(e Event)
+	close()
+}
+
+// the event log of the process, set by ConfigureEvents before the nodes start
+var eventTarget string
+var eventLevel = LEVEL_INFO
+
+// ConfigureEvents sets where the nodes of the process log their events: a directory with a file per node,
+// or EVENTS_TO_CONTROLLER. Without a target, the nodes print their events as before.
+func ConfigureEvents(target string, level string) error {
+	if _, ok := levelRank[level]; !ok {
+		return fmt.Errorf("unknown event level %s", level)
+	}
+	if target != "" && target != EVENTS_TO_CONTROLLER {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+	}
+	eventTarget, eventLevel = target, level
+	return nil
+}
+
+// fileSink writes the events as json lines
+type fileSink struct {
+	lock sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *fileSink) write(e Event) {
+	s.encode(e)
+}
+
+func (s *fileSink) encode(v interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.enc != nil {
+		s.enc.Encode(v)
+	}
+}
+
+func (s *fileSink) writeAll(events []Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.enc == nil {
+		return fmt.Errorf("%s is closed", s.file.Name())
+	}
+	for _, e := range events {
+		if err := s.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.enc != nil {
+		s.enc = nil
+		s.file.Close()
+	}
+}
+
+// collectorSink sends the events in batches to the controller
+type collectorSink struct {
+	events  chan Event
+	stop    chan bool
+	done    chan bool
+	stopped sync.Once
+}
+
+func newCollectorSink(controlAddress string) *collectorSink {
+	s := &collectorSink{events: make(chan Event, EVENT_BUFFER), stop: make(chan bool), done: make(chan bool)}
+	go s.run(controlAddress)
+	return s
+}
+
+func (s *collectorSink) write(e Event) {
+	select {
+	case s.events <- e:
+	default:
+		processMetrics.Add("rvr_events_dropped_total", "events the collector could not keep up with", "", 1)
+	}
+}
+
+// close sends the events still waiting and stops the collector
+func (s *collectorSink) close() {
+	s.stopped.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+func (s *collectorSink) run(controlAddress string) {
+	defer close(s.done)
+	flush := time.NewTicker(EVENT_FLUSH)
+	defer flush.Stop()
+	batch := make([]Event, 0, EVENT_BATCH)
+	send := func() {
+		if err := RpcCall(controlAddress, "ControllerState.CollectEvents", batch, nil, EVENT_FLUSH); err != nil {
+			processMetrics.Add("rvr_events_dropped_total", "events the collector could not keep up with", "", float64(len(batch)))
+		}
+		batch = make([]Event, 0, EVENT_BATCH)
+	}
+	for {
+		select {
+		case e := <-s.events:
+			batch = append(batch, e)
+			if len(batch) >= EVENT_BATCH {
+				send()
+			}
+		case <-flush.C:
+			if len(batch) > 0 {
+				send()
+			}
+		case <-s.stop:
+			for len(s.events) > 0 {
+				if batch = append(batch, <-s.events); len(batch) >= EVENT_BATCH {
+					send()
+				}
+			}
+			if len(batch) > 0 {
+				send()
+			}
+			return
+		}
+	}
+}
+
+// openEvents opens the event log of the node once it knows its identity
+func (p *ProtocolState) openEvents() {
+	switch eventTarget {
+	case "":
+		return
+	case EVENTS_TO_CONTROLLER:
+		p.events = newCollectorSink(p.ControlAddress)
+	default:
+		sink, err := newFileSink(filepath.Join(eventTarget, fmt.Sprintf("%X.jsonl", p.MyId.GetUUID())))
+		if err != nil {
+			fmt.Printf("%s: unable to open the event log: %s\n", p.MyId.Address, err)
+			return
+		}
+		p.events = sink
+	}
+}
+
+// closeLogs closes the event log and the message trace of the node once it exits
+func (p *ProtocolState) closeLogs() {
+	if p.events != nil {
+		p.events.close()
+	}
+	if p.trace != nil {
+		p.trace.close()
+	}
+}
+
+// logEvent logs an event of the node; without an event log, the message is printed as before.
+// The round and the phase are read without the lock, the caller may hold it.
+func (p *ProtocolState) logEvent(level string, name string, format string, args ...interface{}) {
+	p.logFields(level, name, nil, format, args...)
+}
+
+func (p *ProtocolState) logFields(level string, name string, fields map[string]interface{}, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if p.events == nil {
+		fmt.Println(message)
+		return
+	}
+	if levelRank[level] < levelRank[eventLevel] {
+		return
+	}
+	p.events.write(Event{
+		Time:       time.Now(),
+		Level:      level,
+		Node:       fmt.Sprintf("%X", p.MyId.GetUUID()),
+		Address:    p.MyId.Address,
+		Session:    p.session,
+		Round:      p.Round,
+		Repetition: p.Repetition,
+		Phase:      phaseLabel(p.CurrentProto),
+		Name:       name,
+		Message:    message,
+		Fields:     fields,
+	})
+}
+
+func (c *ControllerState) CollectEvents(events []Event, rtv *int) error {
+	// appends the events sent by the nodes to the collected log
+	c.collectLock.Lock()
+	defer c.collectLock.Unlock()
+	if c.collected == nil {
+		dir := eventTarget
+		if dir == "" || dir == EVENTS_TO_CONTROLLER {
+			dir = "."
+		}
+		sink, err := newFileSink(filepath.Join(dir, "collected.jsonl"))
+		if err != nil {
+			return err
+		}
+		c.collected = sink
+	}
+	return c.collected.writeAll(events)
+}
+
+// ReadEvents reads an event log of json lines
+func ReadEvents(r io.Reader) ([]Event, error) {
+	events := make([]Event, 0)
+	err := readJSONLines(r, func(decode func(v interface{}) error) error {
+		e := Event{}
+		if err := decode(&e); err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	})
+	return events, err
+}
+
+// readJSONLines calls read with the decoder of every line that is not empty
+func readJSONLines(r io.Reader, read func(decode func(v interface{}) error) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		decode := func(v interface{}) error { return json.Unmarshal(scanner.Bytes(), v) }
+		if err := read(decode); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// mergeEvents orders the events into one timeline: the sessions in the order they started,
+// then by round, then by time
+func mergeEvents(events []Event) []Event {
+	sessionStart := make(map[uint64]time.Time)
+	for _, e := range events {
+		if start, ok := sessionStart[e.Session]; !ok || e.Time.Before(start) {
+			sessionStart[e.Session] = e.Time
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a.Session != b.Session {
+			return sessionStart[a.Session].Before(sessionStart[b.Session])
+		}
+		if a.Round != b.Round {
+			return a.Round < b.Round
+		}
+		return a.Time.Before(b.Time)
+	})
+	return events
+}
+
+// MergeEventFiles merges the event logs of the nodes, or the collected log, into one timeline of json lines
+func MergeEventFiles(files []string, w io.Writer) error {
+	all := make([]Event, 0)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		events, err := ReadEvents(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		all = append(all, events...)
+	}
+	enc := json.NewEncoder(w)
+	for _, e := range mergeEvents(all) {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package algorithm
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memorySink struct {
+	events []Event
+}
+
+func (s *memorySink) write(e Event) {
+	s.events = append(s.events, e)
+}
+
+func (s *memorySink) close() {}
+
+func TestEvents_level(t *testing.T) {
+	defer func(level string) { eventLevel = level }(eventLevel)
+	eventLevel = LEVEL_WARN
+	sink := &memorySink{}
+	var p ProtocolState
+	p.MyId.Address = "a:1"
+	p.Round = 4
+	p.CurrentProto = "Sample"
+	p.session = 9
+	p.events = sink
+	p.logEvent(LEVEL_INFO, "setup", "Node setup done")
+	p.logFields(LEVEL_WARN, "sample_failed", map[string]interface{}{"received": 3}, "Sample Failed on Round: %d", p.Round)
+	if len(sink.events) != 1 {
+		t.Fatalf("expected only the warning, got %v", sink.events)
+	}
+	e := sink.events[0]
+	if e.Name != "sample_failed" || e.Message != "Sample Failed on Round: 4" || e.Round != 4 || e.Phase != "Sample" ||
+		e.Session != 9 || e.Address != "a:1" || e.Fields["received"] != 3 {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestMergeEvents(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	a := []Event{
+		{Time: at(10), Session: 2, Round: 0, Name: "a-later-session"},
+		{Time: at(1), Session: 1, Round: 0, Name: "a-0"},
+		{Time: at(5), Session: 1, Round: 2, Name: "a-2"},
+	}
+	b := []Event{
+		{Time: at(2), Session: 1, Round: 0, Name: "b-0"},
+		// a late clock does not move the event before its round
+		{Time: at(0), Session: 1, Round: 1, Name: "b-1"},
+	}
+	var buf bytes.Buffer
+	for _, events := range [][]Event{a, b} {
+		path := filepath.Join(t.TempDir(), "events.jsonl")
+		sink, err := newFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sink.writeAll(events); err != nil {
+			t.Fatal(err)
+		}
+		sink.close()
+		if err = sink.writeAll(events); err == nil {
+			t.Errorf("wrote to a closed sink")
+		}
+		if err = MergeEventFiles([]string{path}, &buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, err := ReadEvents(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 5 || !all[0].Time.Equal(at(1)) {
+		t.Fatalf("the events did not survive the round trip: %+v", all)
+	}
+	names := make([]string, 0)
+	for _, e := range mergeEvents(all) {
+		names = append(names, e.Name)
+	}
+	if got := strings.Join(names, " "); got != "a-0 b-0 b-1 a-2 a-later-session" {
+		t.Errorf("unexpected timeline %s", got)
+	}
+}
+
+func TestReadEvents_malformed(t *testing.T) {
+	if _, err := ReadEvents(strings.NewReader("{\"event\":\"ok\"}\n\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected an error on line 3, got %v", err)
+	}
+}
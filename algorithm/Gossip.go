@@ -3,28 +3,199 @@ package algorithm
 import (
 	"RVR/message"
 	"bytes"
+	"fmt"
 	"math"
 	"math/rand"
 )
 
+const (
+	GOSSIP_MODE_FULL  = "full"  // the leader sends its full view to every gossip target
+	GOSSIP_MODE_DELTA = "delta" // nodes advertise their view, the leader sends the difference only
+
+	DEFAULT_DELTA_CELLS = 96
+	DEFAULT_RELAY_TTL   = 3
+)
+
+// GossipStats counts the delta transfers of a node over all repetitions
+type GossipStats struct {
+	AdvertsSent   int // view adverts sent to the leader
+	DeltasSent    int // differences sent as the leader
+	DeltasApplied int // differences received and reconciled with the proposal
+	Fallbacks     int // adverts answered with the full proposal, because the difference cannot be decoded
+	BytesSaved    int // bytes of the full proposals replaced by differences, ByteCount only counts the differences
+	Relayed       int // proposals forwarded to other peers
+	Duplicates    int // copies of the proposal received after the first one
+}
+
+func (s *GossipStats) String() string {
+	return fmt.Sprintf("adverts sent: %d, deltas sent: %d, deltas applied: %d, fallbacks: %d, bytes saved: %d, "+
+		"relayed: %d, duplicates: %d",
+		s.AdvertsSent, s.DeltasSent, s.DeltasApplied, s.Fallbacks, s.BytesSaved, s.Relayed, s.Duplicates)
+}
+
 func gossipSketch(p *ProtocolState) (round int){
 	round = 1
 	round += p.x
 	return round
 }
 
-func Gossip(p *ProtocolState, leader *message.Identity) []uint64{
+// sendGossipAdvert sends the digest and the IBLT of the view to the leader, so
+// the leader can answer with the difference to its proposal only
+func (p *ProtocolState) sendGossipAdvert(leader *message.Identity) {
+	advert := new(message.Message)
+	p.lock.RLock()
+	advert.Round = p.Round
+	addr, ok := p.idToAddrMap[leader.GetUUID()]
+	p.lock.RUnlock()
+	if !ok {
+		return
+	}
+	advert.Sender = p.MyId
+	advert.Nonce = p.View.Digest()
+	advert.Sketch = message.IBLTFromView(p.View, p.deltaCells).Encode()
+	advert.Type = "Gossip Advert"
+	advert.Sign(p.privateKey)
+	p.sendMsgToPeerAsync(*advert, addr)
+	p.lock.Lock()
+	p.GossipStats.AdvertsSent++
+	p.lock.Unlock()
+}
 
-	<- p.ticker
+// gossipDelta builds the difference between the proposal and the advertised view,
+// ok is false if the advert cannot be decoded against the proposal
+func (p *ProtocolState) gossipDelta(proposal message.View, own *message.IBLT, advert *message.Message) (*message.Message, bool) {
+	if bytes.Equal(advert.Nonce, proposal.Digest()) {
+		// nothing to reconcile
+		return p.signedDelta(proposal, nil, nil), true
+	}
+	theirs, err := message.DecodeIBLT(advert.Sketch)
+	if err != nil {
+		return nil, false
+	}
+	diff, err := own.Subtract(theirs)
+	if err != nil {
+		return nil, false
+	}
+	added, removed, err := diff.Decode()
+	if err != nil {
+		return nil, false
+	}
+	return p.signedDelta(proposal, added, removed), true
+}
+
+func (p *ProtocolState) signedDelta(proposal message.View, added message.View, removed message.View) *message.Message {
+	delta := new(message.Message)
+	delta.Round = p.Round
+	delta.Sender = p.MyId
+	delta.View = added
+	if len(removed) > 0 {
+		delta.Sketch = removed.Encode()
+	}
+	delta.Nonce = proposal.Digest() // the receiver checks the reconciled view against it
+	delta.Type = "Gossip Delta"
+	delta.Sign(p.privateKey)
+	return delta
+}
+
+// answerAdverts lets the leader answer the adverts received so far, with the
+// difference if it can be decoded, and with the full proposal otherwise
+func (p *ProtocolState) answerAdverts(full *message.Message, proposal message.View, answered map[uint64]bool) {
+	p.lock.Lock()
+	adverts := make([]message.Message, 0)
+	for _, m := range p.inQueue {
+		if m.Type == "Gossip Advert" {
+			adverts = append(adverts, m)
+		}
+	}
+	p.inQueue = make([]message.Message, 0)
+	p.lock.Unlock()
+
+	own := message.IBLTFromView(proposal, p.deltaCells)
+	fullSize := int(full.Size())
+	for i, _ := range adverts {
+		uuid := adverts[i].Sender.GetUUID()
+		p.lock.RLock()
+		addr, ok := p.idToAddrMap[uuid]
+		p.lock.RUnlock()
+		if !ok || answered[uuid] {
+			continue
+		}
+		answered[uuid] = true
+		delta, ok := p.gossipDelta(proposal, own, &adverts[i])
+		p.lock.Lock()
+		if ok {
+			p.GossipStats.DeltasSent++
+			p.GossipStats.BytesSaved += fullSize - int(delta.Size())
+		} else {
+			p.GossipStats.Fallbacks++
+			delta = full
+		}
+		p.lock.Unlock()
+		p.sendMsgToPeerAsync(*delta, addr)
+	}
+}
+
+// relayProposal forwards the leader's proposal to relayFanout random peers of the initView.
+// The message stays signed by the leader, only Hops changes. Differences are not relayed,
+// they only reconcile against the view of the node they are meant for.
+// Hops is not signed: a Byzantine relay can raise it to relayTTL and stop its copies from
+// spreading further; the leader still sends to a fresh relayFanout of its peers every round.
+func (p *ProtocolState) relayProposal(m message.Message) {
+	if p.relayFanout <= 0 || m.Type != "Gossip Message" || m.Hops >= p.relayTTL {
+		return
+	}
+	m.Hops++
+	p.lock.RLock()
+	sent := 0
+	for _, i := range rand.Perm(len(p.initView)) {
+		if sent >= p.relayFanout {
+			break
+		}
+		uuid := p.initView[i].GetUUID()
+		if uuid == p.MyId.GetUUID() || uuid == m.Sender.GetUUID() {
+			continue
+		}
+		p.sendMsgToPeerAsync(m, p.initView[i].Address)
+		sent++
+	}
+	p.lock.RUnlock()
+	p.lock.Lock()
+	p.GossipStats.Relayed++
+	p.lock.Unlock()
+}
+
+// applyDelta reconciles the view with a difference received from the leader
+func (p *ProtocolState) applyDelta(m *message.Message) (message.View, bool) {
+	var removed message.View
+	if len(m.Sketch) > 0 {
+		var err error
+		removed, err = message.DecodeView(m.Sketch)
+		if err != nil {
+			p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: malformed delta")
+			return nil, false
+		}
+	}
+	view := p.View.Union(m.View).Difference(removed)
+	if !bytes.Equal(view.Digest(), m.Nonce) {
+		p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: delta does not reconcile to the proposal")
+		return nil, false
+	}
+	return view, true
+}
+
+func Gossip(p *ProtocolState, leader *message.Identity) message.View{
+
+	p.tick()
 	p.lock.Lock()
 	p.Round++
 	p.lock.Unlock()
 
 
-	var proposal []uint64
+	var proposal message.View
+	p.proposalHops = -1
 	if leader.Public_key == nil{
 		for i := 0; i < p.x; i++{
-			<- p.ticker
+			p.tick()
 			p.lock.Lock()
 			p.Round++
 			p.lock.Unlock()
@@ -32,7 +203,9 @@ func Gossip(p *ProtocolState, leader *message.Identity) []uint64{
 		return proposal
 	}
 	var msg message.Message
-	if bytes.Equal(leader.Public_key, p.MyId.Public_key){
+	isLeader := bytes.Equal(leader.Public_key, p.MyId.Public_key)
+	if isLeader{
+		p.proposalHops = 0
 		proposal = p.View
 		msg.Round = p.Round
 		msg.View = proposal
@@ -41,9 +214,15 @@ func Gossip(p *ProtocolState, leader *message.Identity) []uint64{
 		msg.Sign(p.privateKey)
 	}else {proposal = nil}
 
+	deltaMode := p.gossipMode == GOSSIP_MODE_DELTA
+	if deltaMode && !isLeader {
+		p.sendGossipAdvert(leader)
+	}
+	answered := make(map[uint64]bool) // the advertisers the leader has answered
+
 	for i := 0; i < p.x; i++{
 		// notice to facilitate gossip, we only increase the Round at the end
-		<- p.ticker
+		p.tick()
 		// p.Round++ (defered to the end of this function)
 		if proposal == nil{
 			// try to receive from initview
@@ -51,8 +230,21 @@ func Gossip(p *ProtocolState, leader *message.Identity) []uint64{
 			for _, m := range p.inQueue {
 				if _, ok := p.idToAddrMap[m.Sender.GetUUID()]; ok {
 					if bytes.Equal(m.Sender.Public_key, leader.Public_key){
-						proposal = m.View
+						if m.Type == "Gossip Delta" {
+							view, ok := p.applyDelta(&m)
+							if !ok {
+								p.traceReceive(&m, TRACE_INVALID)
+								continue
+							}
+							p.GossipStats.DeltasApplied++
+							proposal = view
+						} else if m.Type == "Gossip Message" {
+							proposal = m.View
+						} else {
+							continue
+						}
 						msg = m
+						p.traceReceive(&m, TRACE_COUNTED)
 						break
 					}
 				} else {
@@ -60,13 +252,50 @@ func Gossip(p *ProtocolState, leader *message.Identity) []uint64{
 				}
 			}
 			p.inQueue = make([]message.Message, 0)
+			if proposal != nil {
+				p.proposalHops = msg.Hops
+			}
+			p.lock.Unlock()
+			if proposal != nil {
+				p.relayProposal(msg)
+			}
+		} else if !isLeader {
+			// drop the relayed copies of the proposal
+			p.lock.Lock()
+			rest := make([]message.Message, 0)
+			for _, m := range p.inQueue {
+				if m.Type == "Gossip Message" {
+					p.GossipStats.Duplicates++
+				} else {
+					rest = append(rest, m)
+				}
+			}
+			p.inQueue = rest
 			p.lock.Unlock()
 		} else {
-			// deliver to 8(1+f)ln|initview| / delta members in initview
+			if deltaMode {
+				p.answerAdverts(&msg, proposal, answered)
+				if i == 0 && p.x > 1 {
+					// hold the full proposal for one round while the adverts arrive
+					continue
+				}
+			}
+			// deliver to 8(1+f)ln|initview| / delta members in initview,
+			// with the relay the peers spread it further, so relayFanout of them is enough
 			p.lock.RLock()
 			gossipSize := int(math.Min(float64(len(p.initView)),math.Ceil(8 * (1+p.f) * math.Log(float64(len(p.initView))) / p.delta)))
+			if p.relayFanout > 0 && p.relayFanout < gossipSize {
+				gossipSize = p.relayFanout
+			}
 			perm := rand.Perm(gossipSize)
+			if p.relayFanout > 0 {
+				// a fresh random subset every round
+				perm = rand.Perm(len(p.initView))[:gossipSize]
+			}
 			for _,i := range perm {
+				if answered[p.initView[i].GetUUID()] {
+					continue
+				}
 				p.sendMsgToPeerAsync(msg, p.initView[i].Address)
 			}
 			p.lock.RUnlock()
@@ -78,4 +307,4 @@ func Gossip(p *ProtocolState, leader *message.Identity) []uint64{
 	p.lock.Unlock()
 
 	return proposal
-}
\ No newline at end of file
+}
@@ -1,6 +1,7 @@
 package algorithm
 
 import (
+	"math/rand"
 	"testing"
 	"RVR/message"
 )
@@ -81,3 +82,104 @@ func TestGossip(t *testing.T) {
 
 
 }
+
+func TestGossip_delta(t *testing.T) {
+	var leader, node ProtocolState
+	leader.init()
+	node.init()
+	proposal := make([]uint64, 0)
+	for i := 0; i < 200; i++ {
+		proposal = append(proposal, rand.Uint64())
+	}
+	leader.View = message.NewView(proposal)
+	node.View = message.NewView(append(proposal[5:190:190], 1000, 1001))
+
+	advert := message.Message{Nonce: node.View.Digest(), Sketch: message.IBLTFromView(node.View, DEFAULT_DELTA_CELLS).Encode()}
+	delta, ok := leader.gossipDelta(leader.View, message.IBLTFromView(leader.View, DEFAULT_DELTA_CELLS), &advert)
+	if !ok {
+		t.Fatalf("difference of %d ids is not decoded", 17)
+	}
+	view, ok := node.applyDelta(delta)
+	if !ok || !view.Equal(leader.View) {
+		t.Errorf("reconciled view differs from the proposal")
+	}
+	full := message.Message{View: leader.View, Sender: leader.MyId}
+	full.Sign(leader.privateKey)
+	if delta.Size() >= full.Size() {
+		t.Errorf("delta of %d bytes is not smaller than the full proposal of %d bytes", delta.Size(), full.Size())
+	}
+
+	// a forged difference does not reconcile to the proposal digest
+	delta.View = append(delta.View, 5000)
+	if _, ok := node.applyDelta(delta); ok {
+		t.Errorf("forged delta accepted")
+	}
+
+	// too large a difference falls back to the full proposal
+	advert = message.Message{Nonce: message.View{}.Digest(), Sketch: message.IBLTFromView(message.View{}, DEFAULT_DELTA_CELLS).Encode()}
+	if _, ok := leader.gossipDelta(leader.View, message.IBLTFromView(leader.View, DEFAULT_DELTA_CELLS), &advert); ok {
+		t.Errorf("difference of 200 ids decoded with %d cells", DEFAULT_DELTA_CELLS)
+	}
+}
+
+func TestGossip_relay(t *testing.T) {
+	TEST_SIZE := 12
+	syncLock := make(chan bool)
+	peers := make([]ProtocolState, TEST_SIZE)
+	for i, _ := range peers {
+		go func(i int) {
+			peers[i].init()
+			peers[i].View = []uint64{uint64(i)}
+			syncLock <- true
+		}(i)
+	}
+	for i := 0; i < TEST_SIZE; i++ {
+		<-syncLock
+	}
+	for i, _ := range peers {
+		for j, _ := range peers {
+			peers[i].addToInitView(peers[j].MyId)
+		}
+		// too few rounds for the leader to reach everyone on its own
+		peers[i].x = 4
+		peers[i].relayFanout = 2
+		peers[i].relayTTL = 2
+	}
+
+	leader := peers[0].MyId
+	proposalResult := make([]message.View, TEST_SIZE)
+	for i, _ := range peers {
+		go func(i int) {
+			proposalResult[i] = Gossip(&peers[i], &leader)
+			syncLock <- true
+		}(i)
+	}
+	for i := 0; i < TEST_SIZE; i++ {
+		<-syncLock
+	}
+
+	relayed, duplicates := 0, 0
+	for i := 1; i < TEST_SIZE; i++ {
+		p := &peers[i]
+		if proposalResult[i] != nil && !proposalResult[i].Equal(peers[0].View) {
+			t.Errorf("node %d received another view: %v", i, proposalResult[i])
+		}
+		if p.proposalHops > p.relayTTL {
+			t.Errorf("node %d received the proposal after %d hops, beyond the ttl", i, p.proposalHops)
+		}
+		if p.proposalHops > 0 {
+			relayed++
+		}
+		// a node forwards the proposal once, the copies it receives later are dropped
+		if p.GossipStats.Relayed > 1 {
+			t.Errorf("node %d relayed the proposal %d times", i, p.GossipStats.Relayed)
+		}
+		duplicates += p.GossipStats.Duplicates
+	}
+	if relayed == 0 {
+		t.Errorf("no node received the proposal through a relay")
+	}
+	if duplicates == 0 {
+		t.Errorf("no duplicate dropped")
+	}
+}
@@ -0,0 +1,142 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// the number of repetitions a node keeps in its history
+const MAX_HISTORY = 256
+
+// RepetitionRecord is the state of a node at the end of one repetition
+type RepetitionRecord struct {
+	Repetition       int
+	Round            int
+	ViewDigest       []byte
+	ViewSize         int
+	Leader           uint64 // UUID of the leader, 0 if the election failed
+	ProposalReceived bool   // whether the leader's proposal is received in Gossip
+	ProposalAdopted  bool   // whether the view after Compute is the leader's proposal
+	ProposalHops     int    // relays the proposal went through before it was received, -1 if not received
+}
+
+func (p *ProtocolState) recordRepetition(repetition int, leader *message.Identity, proposal message.View) {
+	record := RepetitionRecord{
+		Repetition:       repetition,
+		Round:            p.Round,
+		ViewDigest:       p.View.Digest(),
+		ViewSize:         len(p.View),
+		ProposalReceived: proposal != nil,
+		ProposalHops:     p.proposalHops,
+	}
+	if leader.Public_key != nil {
+		record.Leader = leader.GetUUID()
+	}
+	if proposal != nil {
+		record.ProposalAdopted = proposal.Equal(p.View)
+	}
+	p.lock.Lock()
+	p.History = append(p.History, record)
+	if len(p.History) > MAX_HISTORY {
+		p.History = p.History[len(p.History)-MAX_HISTORY:]
+	}
+	p.lock.Unlock()
+}
+
+func (p *ProtocolState) RetrieveHistory(ph int, history *[]RepetitionRecord) error {
+	// returns the per-repetition history of the node to the controller
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	*history = make([]RepetitionRecord, len(p.History))
+	copy(*history, p.History)
+	return nil
+}
+
+// ConvergencePoint summarises the honest views at the end of one repetition
+type ConvergencePoint struct {
+	Repetition       int
+	Round            int     // the largest round reported
+	Nodes            int     // nodes that reported this repetition
+	DistinctViews    int     // number of distinct view digests
+	Agreement        float64 // fraction of nodes holding the most common view
+	ProposalReceived float64 // fraction of nodes that received the leader's proposal
+	ProposalAdopted  float64 // fraction of nodes that adopted the leader's proposal
+	MeanHops         float64 // mean relays of the received proposals
+}
+
+// convergenceTrace lines up the histories of the honest nodes by repetition
+func convergenceTrace(histories [][]RepetitionRecord) []ConvergencePoint {
+	byRepetition := make(map[int][]RepetitionRecord)
+	for _, history := range histories {
+		for _, record := range history {
+			byRepetition[record.Repetition] = append(byRepetition[record.Repetition], record)
+		}
+	}
+	trace := make([]ConvergencePoint, 0, len(byRepetition))
+	for repetition, records := range byRepetition {
+		point := ConvergencePoint{Repetition: repetition, Nodes: len(records)}
+		digestCount := make(map[string]int)
+		received, adopted, majority, hops := 0, 0, 0, 0
+		for _, record := range records {
+			digestCount[string(record.ViewDigest)]++
+			if record.ProposalReceived {
+				received++
+				hops += record.ProposalHops
+			}
+			if record.ProposalAdopted {
+				adopted++
+			}
+			if record.Round > point.Round {
+				point.Round = record.Round
+			}
+		}
+		for _, count := range digestCount {
+			if count > majority {
+				majority = count
+			}
+		}
+		point.DistinctViews = len(digestCount)
+		point.Agreement = float64(majority) / float64(len(records))
+		point.ProposalReceived = float64(received) / float64(len(records))
+		point.ProposalAdopted = float64(adopted) / float64(len(records))
+		if received > 0 {
+			point.MeanHops = float64(hops) / float64(received)
+		}
+		trace = append(trace, point)
+	}
+	sort.Slice(trace, func(i, j int) bool { return trace[i].Repetition < trace[j].Repetition })
+	return trace
+}
+
+// firstAgreement returns the first repetition after which all honest views are equal, -1 if none
+func firstAgreement(trace []ConvergencePoint) int {
+	for _, point := range trace {
+		if point.DistinctViews == 1 {
+			return point.Repetition
+		}
+	}
+	return -1
+}
+
+// agreementRound returns the round at the end of the first repetition after which all honest views are equal, -1 if none
+func agreementRound(trace []ConvergencePoint) int {
+	for _, point := range trace {
+		if point.DistinctViews == 1 {
+			return point.Round
+		}
+	}
+	return -1
+}
+
+func convergenceString(trace []ConvergencePoint) string {
+	var b strings.Builder
+	b.WriteString("repetition, round, nodes, distinct views, agreement, proposal received, proposal adopted, mean hops\n")
+	for _, point := range trace {
+		fmt.Fprintf(&b, "%d, %d, %d, %d, %f, %f, %f, %f\n", point.Repetition, point.Round, point.Nodes,
+			point.DistinctViews, point.Agreement, point.ProposalReceived, point.ProposalAdopted, point.MeanHops)
+	}
+	fmt.Fprintf(&b, "honest views first agreed after repetition: %d\n", firstAgreement(trace))
+	return b.String()
+}
@@ -0,0 +1,36 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"testing"
+)
+
+func TestConvergenceTrace(t *testing.T) {
+	a := message.NewView([]uint64{1, 2, 3}).Digest()
+	c := message.NewView([]uint64{1, 2}).Digest()
+
+	histories := [][]RepetitionRecord{
+		{{Repetition: 0, Round: 20, ViewDigest: a, ProposalReceived: true}, {Repetition: 1, Round: 40, ViewDigest: a, ProposalAdopted: true}},
+		{{Repetition: 0, Round: 20, ViewDigest: c}, {Repetition: 1, Round: 41, ViewDigest: a}},
+		{{Repetition: 0, Round: 20, ViewDigest: a}, {Repetition: 1, Round: 40, ViewDigest: a}},
+	}
+	trace := convergenceTrace(histories)
+	if len(trace) != 2 {
+		t.Fatalf("wrong number of repetitions: %d", len(trace))
+	}
+	if trace[0].DistinctViews != 2 || trace[0].Agreement != 2.0/3.0 {
+		t.Errorf("wrong first repetition: %+v", trace[0])
+	}
+	if trace[1].DistinctViews != 1 || trace[1].Agreement != 1 {
+		t.Errorf("wrong second repetition: %+v", trace[1])
+	}
+	if first := firstAgreement(trace); first != 1 {
+		t.Errorf("wrong first agreement: %d", first)
+	}
+	if round := agreementRound(trace); round != 41 {
+		t.Errorf("wrong agreement round: %d", round)
+	}
+	if round := agreementRound(trace[:1]); round != -1 {
+		t.Errorf("agreement round without agreement: %d", round)
+	}
+}
@@ -0,0 +1,215 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"fmt"
+	"time"
+)
+
+// the number of repetitions between a membership change and the boundary it takes effect at,
+// so the announcement reaches every member first
+const MEMBERSHIP_DELAY = 1
+
+// the number of peers a joining node asks to bootstrap from
+const JOIN_BOOTSTRAP = 3
+
+// MembershipChange adds or removes a node from the initView at the start of a repetition
+type MembershipChange struct {
+	Id         message.Identity
+	Join       bool // false for a leave
+	Repetition int  // the repetition the change takes effect at
+}
+
+// JoinInstruction is sent by the controller to a newly spawned node during a run
+type JoinInstruction struct {
+	Params    ProtocolRPCSetupParams
+	Bootstrap []message.Identity // running members to ask for admission
+}
+
+// JoinReply is the answer of a running member to a join request
+type JoinReply struct {
+	InitView   []message.Identity
+	View       message.View
+	Repetition int // the repetition the joining node is admitted at
+}
+
+// Admission tells a joining node that its repetition is about to start
+type Admission struct {
+	Round      int
+	Repetition int
+	Wait       time.Duration // time until the next round starts at the admitting node
+}
+
+func (p *ProtocolState) Join(instruction JoinInstruction, rtv *int) error {
+	// bootstraps a node into a running protocol, the node starts once it is admitted
+	instruction.Params.InitView = instruction.Bootstrap
+	p.Setup(instruction.Params, nil)
+	return p.bootstrap(instruction.Bootstrap, false)
+}
+
+// bootstrap asks the peers in turn to admit the node, and takes the initView of the first
+// that answers; a recovering node keeps its own view
+func (p *ProtocolState) bootstrap(peers []message.Identity, keepView bool) error {
+	for _, peer := range peers {
+		reply := JoinReply{}
+		err := RpcCall(peer.Address, "ProtocolState.RequestJoin", p.MyId, &reply, p.roundDuration)
+		if err != nil {
+			fmt.Printf("Join: unable to bootstrap from %s: %s\n", peer.Address, err)
+			continue
+		}
+		p.lock.Lock()
+		p.initView = make([]message.Identity, 0, len(reply.InitView)+1)
+		p.idToAddrMap = make(map[uint64]string)
+		for _, id := range reply.InitView {
+			p.admit(id)
+		}
+		p.admit(p.MyId)
+		if !keepView {
+			p.View = message.NewView(reply.View)
+		}
+		p.Repetition = reply.Repetition
+		p.lock.Unlock()
+		fmt.Printf("Join: waiting for admission at repetition %d from %s\n", reply.Repetition, peer.Address)
+		return nil
+	}
+	return fmt.Errorf("no bootstrap peer answered")
+}
+
+func (p *ProtocolState) RequestJoin(id message.Identity, reply *JoinReply) error {
+	// answers a join request, and announces the new member to the initView
+	p.lock.Lock()
+	if p.Finished || p.ticker == nil {
+		p.lock.Unlock()
+		return fmt.Errorf("not running")
+	}
+	change := MembershipChange{id, true, p.Repetition + MEMBERSHIP_DELAY}
+	p.joiners[id.GetUUID()] = change
+	reply.InitView = make([]message.Identity, len(p.initView))
+	copy(reply.InitView, p.initView)
+	reply.View = message.NewView(p.View)
+	reply.Repetition = change.Repetition
+	p.lock.Unlock()
+	p.announce(change)
+	return nil
+}
+
+func (p *ProtocolState) Leave(ph int, rtv *int) error {
+	// announces that the node leaves at the next repetition boundary
+	p.lock.RLock()
+	change := MembershipChange{p.MyId, false, p.Repetition + MEMBERSHIP_DELAY}
+	p.lock.RUnlock()
+	p.announce(change)
+	return nil
+}
+
+func (p *ProtocolState) AnnounceMembership(change MembershipChange, rtv *int) error {
+	// queues a membership change until its repetition starts
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, pending := range p.pendingChanges {
+		if pending.Id.GetUUID() == change.Id.GetUUID() && pending.Join == change.Join {
+			return nil
+		}
+	}
+	p.pendingChanges = append(p.pendingChanges, change)
+	return nil
+}
+
+func (p *ProtocolState) Admit(admission Admission, rtv *int) error {
+	// starts a joined node in step with the node that admits it
+	p.lock.Lock()
+	if p.ticker != nil {
+		p.lock.Unlock()
+		return fmt.Errorf("already started")
+	}
+	p.Round = admission.Round
+	p.Repetition = admission.Repetition
+	p.lock.Unlock()
+	go func() {
+		time.Sleep(admission.Wait)
+		p.lock.Lock()
+		p.ticker = tickNow(p.roundDuration)
+		p.lock.Unlock()
+		p.launch()
+	}()
+	return nil
+}
+
+// announce queues the change locally, and sends it to every other member of the initView
+func (p *ProtocolState) announce(change MembershipChange) {
+	p.AnnounceMembership(change, nil)
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	for i, _ := range p.initView {
+		if p.initView[i].GetUUID() == p.MyId.GetUUID() {
+			continue
+		}
+		go RpcCall(p.initView[i].Address, "ProtocolState.AnnounceMembership", change, nil, p.roundDuration)
+	}
+}
+
+// applyMembership applies the changes due at the start of the repetition,
+// and admits the nodes that joined through this node. It returns whether this node leaves.
+func (p *ProtocolState) applyMembership(repetition int) (leave bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	rest := make([]MembershipChange, 0)
+	for _, change := range p.pendingChanges {
+		if change.Repetition > repetition {
+			rest = append(rest, change)
+			continue
+		}
+		if change.Join {
+			p.admit(change.Id)
+		} else if change.Id.GetUUID() == p.MyId.GetUUID() {
+			leave = true
+		} else {
+			p.removeFromInitView(change.Id.Address)
+		}
+	}
+	p.pendingChanges = rest
+
+	if p.ticker == nil {
+		return
+	}
+	for uuid, change := range p.joiners {
+		if change.Repetition > repetition {
+			continue
+		}
+		delete(p.joiners, uuid)
+		admission := Admission{p.Round, repetition, p.untilNextRound()}
+		go RpcCall(change.Id.Address, "ProtocolState.Admit", admission, nil, p.roundDuration)
+	}
+	return
+}
+
+// admit adds a member to the initView; unlike addToInitView it keeps p.x,
+// the rounds of Gossip have to stay the same on every node during a run
+func (p *ProtocolState) admit(id message.Identity) {
+	if _, ok := p.idToAddrMap[id.GetUUID()]; !ok {
+		p.initView = append(p.initView, id)
+		p.idToAddrMap[id.GetUUID()] = id.Address
+	}
+}
+
+// untilNextRound is the time until the ticker started at StartTime fires next
+func (p *ProtocolState) untilNextRound() time.Duration {
+	elapsed := time.Since(p.StartTime)
+	return p.roundDuration - elapsed%p.roundDuration
+}
+
+// tickNow returns a ticker that fires at once, and every period after
+func tickNow(period time.Duration) <-chan time.Time {
+	ticks := make(chan time.Time, 1)
+	ticks <- time.Now()
+	go func() {
+		for t := range time.Tick(period) {
+			select {
+			case ticks <- t:
+			default:
+				// drop the tick for a slow receiver, like time.Tick does
+			}
+		}
+	}()
+	return ticks
+}
@@ -0,0 +1,80 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"testing"
+	"time"
+)
+
+func TestProtocolState_applyMembership(t *testing.T) {
+	peers := make([]ProtocolState, 4)
+	for i, _ := range peers {
+		peers[i].init()
+	}
+	for i := 0; i < 3; i++ {
+		peers[0].addToInitView(peers[i].MyId)
+	}
+	x := peers[0].x
+
+	peers[0].AnnounceMembership(MembershipChange{peers[3].MyId, true, 2}, nil)
+	peers[0].AnnounceMembership(MembershipChange{peers[3].MyId, true, 2}, nil)
+	peers[0].AnnounceMembership(MembershipChange{peers[1].MyId, false, 1}, nil)
+	if len(peers[0].pendingChanges) != 2 {
+		t.Errorf("duplicate announcement queued: %d changes", len(peers[0].pendingChanges))
+	}
+
+	if peers[0].applyMembership(1) {
+		t.Errorf("node leaves on the leave of another node")
+	}
+	if _, ok := peers[0].idToAddrMap[peers[1].MyId.GetUUID()]; ok || len(peers[0].initView) != 2 {
+		t.Errorf("leaving node still in initview")
+	}
+	if _, ok := peers[0].idToAddrMap[peers[3].MyId.GetUUID()]; ok {
+		t.Errorf("joining node admitted before its repetition")
+	}
+	peers[0].applyMembership(2)
+	if _, ok := peers[0].idToAddrMap[peers[3].MyId.GetUUID()]; !ok || len(peers[0].initView) != 3 {
+		t.Errorf("joining node not admitted")
+	}
+	if peers[0].x != x {
+		t.Errorf("gossip rounds changed during the run: %d, was %d", peers[0].x, x)
+	}
+
+	peers[0].AnnounceMembership(MembershipChange{peers[0].MyId, false, 3}, nil)
+	if !peers[0].applyMembership(3) {
+		t.Errorf("node does not leave on its own leave")
+	}
+}
+
+func TestProtocolState_Join(t *testing.T) {
+	peers := make([]ProtocolState, 3)
+	for i, _ := range peers {
+		peers[i].init()
+	}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			peers[i].addToInitView(peers[j].MyId)
+		}
+	}
+	peers[0].Repetition = 4
+	peers[0].View = []uint64{1, 2, 3}
+
+	instruction := JoinInstruction{DefaultSetupParams, []message.Identity{peers[0].MyId}}
+	if err := peers[2].Join(instruction, nil); err != nil {
+		t.Fatalf("join failed: %s", err)
+	}
+	if peers[2].Repetition != 4+MEMBERSHIP_DELAY || len(peers[2].initView) != 3 || !peers[2].View.Equal(peers[0].View) {
+		t.Errorf("wrong join state: repetition %d, initview %d, view %v",
+			peers[2].Repetition, len(peers[2].initView), peers[2].View)
+	}
+	if _, ok := peers[0].joiners[peers[2].MyId.GetUUID()]; !ok {
+		t.Errorf("joiner not waiting for admission at the bootstrap")
+	}
+	// the other members hear of the join from the bootstrap
+	time.Sleep(DefaultSetupParams.RoundDuration)
+	peers[1].lock.RLock()
+	defer peers[1].lock.RUnlock()
+	if len(peers[1].pendingChanges) != 1 || !peers[1].pendingChanges[0].Join {
+		t.Errorf("join not announced: %v", peers[1].pendingChanges)
+	}
+}
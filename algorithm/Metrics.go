@@ -0,0 +1,297 @@
+package algorithm
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the upper bounds of the latency histograms, in seconds
+var LATENCY_BUCKETS = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+const (
+	METRIC_COUNTER   = "counter"
+	METRIC_GAUGE     = "gauge"
+	METRIC_HISTOGRAM = "histogram"
+)
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// metricFamily is the series of one metric, by their labels
+type metricFamily struct {
+	kind       string
+	help       string
+	values     map[string]float64
+	histograms map[string]*histogram
+}
+
+// Metrics is the registry of a process, exposed in the Prometheus text format.
+// Counters and histograms are updated as things happen, gauges are read by the collectors at scrape time.
+type Metrics struct {
+	lock       sync.Mutex
+	families   map[string]*metricFamily
+	collectors []func(m *Metrics)
+	nodes      map[*ProtocolState]bool // the nodes hosted by the process
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{families: make(map[string]*metricFamily), nodes: make(map[*ProtocolState]bool)}
+}
+
+// processMetrics is the registry served at /metrics
+var processMetrics = NewMetrics()
+
+// labels formats pairs of names and values, like labels("node", addr)
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+"="+strconv.Quote(pairs[i+1]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// family is the family of the name, the caller holds m.lock
+func (m *Metrics) family(name string, kind string, help string) *metricFamily {
+	f, ok := m.families[name]
+	if !ok {
+		f = &metricFamily{kind: kind, help: help, values: make(map[string]float64), histograms: make(map[string]*histogram)}
+		m.families[name] = f
+	}
+	return f
+}
+
+func (m *Metrics) Add(name string, help string, labels string, v float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.family(name, METRIC_COUNTER, help).values[labels] += v
+}
+
+// Set sets a gauge, collectors call it at scrape time
+func (m *Metrics) Set(name string, help string, labels string, v float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.family(name, METRIC_GAUGE, help).values[labels] = v
+}
+
+func (m *Metrics) Observe(name string, help string, labels string, v float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f := m.family(name, METRIC_HISTOGRAM, help)
+	h, ok := f.histograms[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(LATENCY_BUCKETS))}
+		f.histograms[labels] = h
+	}
+	for i, bound := range LATENCY_BUCKETS {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Collect registers a function that sets gauges before every scrape
+func (m *Metrics) Collect(collector func(m *Metrics)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.collectors = append(m.collectors, collector)
+}
+
+func (m *Metrics) trackNode(p *ProtocolState) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.nodes[p] = true
+}
+
+func (m *Metrics) untrackNode(p *ProtocolState) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.nodes, p)
+	// the gauges of the node are gone with it
+	node := labels("node", p.MyId.Address)
+	for _, f := range m.families {
+		if f.kind != METRIC_GAUGE {
+			continue
+		}
+		for series, _ := range f.values {
+			if strings.HasPrefix(series, node) {
+				delete(f.values, series)
+			}
+		}
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func series(name string, labels string) string {
+	if labels == "" {
+		return name
+	}
+	return name + "{" + labels + "}"
+}
+
+func withLabel(labels string, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+// WriteText runs the collectors, and writes every family in the Prometheus text format
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.lock.Lock()
+	collectors := append([]func(m *Metrics){}, m.collectors...)
+	m.lock.Unlock()
+	for _, collect := range collectors {
+		collect(m)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	names := make([]string, 0, len(m.families))
+	for name, _ := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		f := m.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind)
+		keys := make([]string, 0)
+		for key, _ := range f.values {
+			keys = append(keys, key)
+		}
+		for key, _ := range f.histograms {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			h, ok := f.histograms[key]
+			if !ok {
+				fmt.Fprintf(&b, "%s %s\n", series(name, key), formatFloat(f.values[key]))
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range LATENCY_BUCKETS {
+				cumulative += h.counts[i]
+				fmt.Fprintf(&b, "%s %d\n", series(name+"_bucket", withLabel(key, labels("le", formatFloat(bound)))), cumulative)
+			}
+			fmt.Fprintf(&b, "%s %d\n", series(name+"_bucket", withLabel(key, `le="+Inf"`)), h.count)
+			fmt.Fprintf(&b, "%s %s\n", series(name+"_sum", key), formatFloat(h.sum))
+			fmt.Fprintf(&b, "%s %d\n", series(name+"_count", key), h.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteText(w)
+}
+
+// collectNodes sets the gauges of the hosted nodes from their state
+func collectNodes(m *Metrics) {
+	m.lock.Lock()
+	nodes := make([]*ProtocolState, 0, len(m.nodes))
+	for p, _ := range m.nodes {
+		nodes = append(nodes, p)
+	}
+	m.lock.Unlock()
+	m.Set("rvr_hosted_nodes", "nodes running in this process", "", float64(len(nodes)))
+	for _, p := range nodes {
+		p.lock.RLock()
+		node := labels("node", p.MyId.Address)
+		gauges := []struct {
+			name string
+			help string
+			v    float64
+		}{
+			{"rvr_round", "current round", float64(p.Round)},
+			{"rvr_repetition", "current repetition", float64(p.Repetition)},
+			{"rvr_finished", "1 once the node finished", boolMetric(p.Finished)},
+			{"rvr_malicious", "1 if the node marked itself malicious", boolMetric(p.Malicious)},
+			{"rvr_view_size", "ids in the view", float64(len(p.View))},
+			{"rvr_messages_sent", "messages sent in this run", float64(p.MsgCount)},
+			{"rvr_bytes_sent", "bytes sent in this run", float64(p.ByteCount)},
+			{"rvr_largest_message_bytes", "largest message sent in this run", float64(p.LargestMsgSize)},
+			{"rvr_messages_received", "messages received in this run", float64(p.MsgReceived)},
+			{"rvr_send_failures", "failed sends in this run", float64(p.FailToSend)},
+			{"rvr_messages_expired", "messages received too late in this run", float64(p.ExpiredMsg)},
+		}
+		phase := p.CurrentProto
+		p.lock.RUnlock()
+		for _, g := range gauges {
+			m.Set(g.name, g.help, node, g.v)
+		}
+		for _, name := range []string{"", "Election", "Sample", "Gossip", "Compute"} {
+			m.Set("rvr_phase", "1 for the phase the node is in, idle before it starts",
+				labels("node", p.MyId.Address, "phase", phaseLabel(name)), boolMetric(name == phase))
+		}
+	}
+}
+
+func phaseLabel(phase string) string {
+	if phase == "" {
+		return "idle"
+	}
+	return phase
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// observeRPC records the latency and the outcome of an outgoing rpc
+func observeRPC(method string, start time.Time, err error) {
+	processMetrics.Observe("rvr_rpc_seconds", "latency of the outgoing rpc calls", labels("method", method),
+		time.Since(start).Seconds())
+	if err != nil {
+		processMetrics.Add("rvr_rpc_errors_total", "failed outgoing rpc calls", labels("method", method), 1)
+	}
+}
+
+// countSent records a message sent by the node in its current phase, the caller holds p.lock
+func (p *ProtocolState) countSent(size int) {
+	p.MsgCount++
+	p.ByteCount += size
+	if p.LargestMsgSize < size {
+		p.LargestMsgSize = size
+	}
+	phase := labels("node", p.MyId.Address, "phase", phaseLabel(p.CurrentProto))
+	processMetrics.Add("rvr_phase_messages_sent_total", "messages sent, by phase", phase, 1)
+	processMetrics.Add("rvr_phase_bytes_sent_total", "bytes sent, by phase", phase, float64(size))
+}
+
+func init() {
+	processMetrics.Collect(collectNodes)
+}
+
+// ServeMetrics serves the metrics of the process at address/metrics
+func ServeMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", processMetrics)
+	go func() {
+		fmt.Printf("Metrics at %s/metrics\n", address)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.Printf("Metrics: %s\n", err)
+		}
+	}()
+}
@@ -0,0 +1,63 @@
+package algorithm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetrics_WriteText(t *testing.T) {
+	m := NewMetrics()
+	m.Add("rvr_test_total", "a counter", labels("node", "a:1", "phase", "Sample"), 2)
+	m.Add("rvr_test_total", "a counter", labels("node", "a:1", "phase", "Sample"), 1)
+	m.Observe("rvr_test_seconds", "a histogram", labels("method", "Ping"), 0.003)
+	m.Observe("rvr_test_seconds", "a histogram", labels("method", "Ping"), 10)
+	m.Collect(func(m *Metrics) {
+		m.Set("rvr_test_gauge", "a gauge", "", 7)
+	})
+	var b strings.Builder
+	if err := m.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	expected := []string{
+		"# TYPE rvr_test_total counter\n",
+		`rvr_test_total{node="a:1",phase="Sample"} 3` + "\n",
+		"# TYPE rvr_test_seconds histogram\n",
+		`rvr_test_seconds_bucket{method="Ping",le="0.0025"} 0` + "\n",
+		`rvr_test_seconds_bucket{method="Ping",le="0.005"} 1` + "\n",
+		`rvr_test_seconds_bucket{method="Ping",le="5"} 1` + "\n",
+		`rvr_test_seconds_bucket{method="Ping",le="+Inf"} 2` + "\n",
+		`rvr_test_seconds_sum{method="Ping"} 10.003` + "\n",
+		`rvr_test_seconds_count{method="Ping"} 2` + "\n",
+		"# TYPE rvr_test_gauge gauge\nrvr_test_gauge 7\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line) {
+			t.Errorf("missing %q in\n%s", line, out)
+		}
+	}
+}
+
+func TestMetrics_nodes(t *testing.T) {
+	m := NewMetrics()
+	m.Collect(collectNodes)
+	var p ProtocolState
+	p.MyId.Address = "a:1"
+	p.Round = 12
+	p.CurrentProto = "Gossip"
+	m.trackNode(&p)
+	var b strings.Builder
+	m.WriteText(&b)
+	for _, line := range []string{"rvr_hosted_nodes 1\n", `rvr_round{node="a:1"} 12`, `rvr_phase{node="a:1",phase="Gossip"} 1`,
+		`rvr_phase{node="a:1",phase="Sample"} 0`} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("missing %q", line)
+		}
+	}
+	m.untrackNode(&p)
+	b.Reset()
+	m.WriteText(&b)
+	if !strings.Contains(b.String(), "rvr_hosted_nodes 0\n") || strings.Contains(b.String(), `rvr_round{node="a:1"}`) {
+		t.Errorf("untracked node still exposed:\n%s", b.String())
+	}
+}
@@ -0,0 +1,239 @@
+package algorithm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DELAY_CONSTANT    = "constant"    // always Delay
+	DELAY_UNIFORM     = "uniform"     // Delay plus uniform in [-Jitter, Jitter]
+	DELAY_NORMAL      = "normal"      // Delay plus normal with deviation Jitter
+	DELAY_EXPONENTIAL = "exponential" // Delay plus exponential with mean Jitter
+)
+
+// LinkProfile is the emulated behaviour of a link, on top of the real network
+type LinkProfile struct {
+	Delay        time.Duration `json:"delay"`
+	Jitter       time.Duration `json:"jitter"`
+	Distribution string        `json:"distribution"` // DELAY_CONSTANT if empty
+	Drop         float64       `json:"drop"`         // probability a message is lost
+	Bandwidth    int           `json:"bandwidth"`    // bytes per second, 0 for no cap
+}
+
+// UnmarshalJSON reads the delay and jitter as durations, like "20ms"
+func (l *LinkProfile) UnmarshalJSON(data []byte) error {
+	type profile LinkProfile
+	aux := struct {
+		*profile
+		Delay  string `json:"delay"`
+		Jitter string `json:"jitter"`
+	}{profile: (*profile)(l)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	var err error
+	if aux.Delay != "" {
+		if l.Delay, err = time.ParseDuration(aux.Delay); err != nil {
+			return err
+		}
+	}
+	if aux.Jitter != "" {
+		if l.Jitter, err = time.ParseDuration(aux.Jitter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LinkRule applies a profile to the messages from From to To, an empty address matches any node
+type LinkRule struct {
+	From    string      `json:"from"`
+	To      string      `json:"to"`
+	Profile LinkProfile `json:"profile"`
+}
+
+// Partition cuts the links between its groups from round From until round To, when it heals.
+// A node in no group reaches every node.
+type Partition struct {
+	Groups [][]string `json:"groups"`
+	From   int        `json:"from"`
+	To     int        `json:"to"`
+}
+
+// NetemConfig is the fault injection of a run, set from the controller. It applies to the protocol
+// messages, sent through sendMsgToPeerAsync and sendMsgToPeerWithTrial; the other calls between
+// nodes, like the membership updates and the probes, and the calls with the controller go through as they are.
+type NetemConfig struct {
+	Seed       int64       `json:"seed"`
+	Default    LinkProfile `json:"default"`
+	Links      []LinkRule  `json:"links"` // the first rule that matches wins over Default
+	Partitions []Partition `json:"partitions"`
+}
+
+func LoadNetemConfig(file string) (NetemConfig, error) {
+	config := NetemConfig{}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return config, err
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %s", file, err)
+	}
+	return config, config.validate()
+}
+
+func (c *NetemConfig) validate() error {
+	profiles := []LinkProfile{c.Default}
+	for _, rule := range c.Links {
+		profiles = append(profiles, rule.Profile)
+	}
+	for _, profile := range profiles {
+		switch profile.Distribution {
+		case "", DELAY_CONSTANT, DELAY_UNIFORM, DELAY_NORMAL, DELAY_EXPONENTIAL:
+		default:
+			return fmt.Errorf("unknown delay distribution %s", profile.Distribution)
+		}
+		if profile.Drop < 0 || profile.Drop > 1 || profile.Delay < 0 || profile.Jitter < 0 || profile.Bandwidth < 0 {
+			return fmt.Errorf("link profile out of range: %+v", profile)
+		}
+	}
+	for _, partition := range c.Partitions {
+		if partition.To < partition.From {
+			return fmt.Errorf("partition heals at round %d before it starts at %d", partition.To, partition.From)
+		}
+	}
+	return nil
+}
+
+// netem shapes the messages a node sends
+type netem struct {
+	lock      sync.Mutex
+	config    NetemConfig
+	rng       *rand.Rand
+	busyUntil map[string]time.Time // when the capped link to a node is free again
+}
+
+func newNetem(config NetemConfig, self string) *netem {
+	seed := config.Seed
+	for _, c := range self {
+		// every node draws its own sequence from the seed
+		seed = seed*31 + int64(c)
+	}
+	return &netem{config: config, rng: rand.New(rand.NewSource(seed)), busyUntil: make(map[string]time.Time)}
+}
+
+func (n *netem) profile(from string, to string) LinkProfile {
+	for _, rule := range n.config.Links {
+		if (rule.From == "" || rule.From == from) && (rule.To == "" || rule.To == to) {
+			return rule.Profile
+		}
+	}
+	return n.config.Default
+}
+
+func groupOf(groups [][]string, addr string) int {
+	for i, group := range groups {
+		for _, member := range group {
+			if member == addr {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// partitioned is whether the link is cut at the round
+func (n *netem) partitioned(from string, to string, round int) bool {
+	for _, partition := range n.config.Partitions {
+		if round < partition.From || round >= partition.To {
+			continue
+		}
+		fromGroup, toGroup := groupOf(partition.Groups, from), groupOf(partition.Groups, to)
+		if fromGroup >= 0 && toGroup >= 0 && fromGroup != toGroup {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *netem) sampleDelay(profile LinkProfile) time.Duration {
+	jitter := float64(profile.Jitter)
+	var extra float64
+	switch profile.Distribution {
+	case DELAY_UNIFORM:
+		extra = (2*n.rng.Float64() - 1) * jitter
+	case DELAY_NORMAL:
+		extra = n.rng.NormFloat64() * jitter
+	case DELAY_EXPONENTIAL:
+		extra = n.rng.ExpFloat64() * jitter
+	}
+	return time.Duration(math.Max(0, float64(profile.Delay)+extra))
+}
+
+// shape decides the fate of a message of the size: dropped, or sent after the delay
+func (n *netem) shape(from string, to string, size int, round int) (delay time.Duration, drop bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.partitioned(from, to, round) {
+		return 0, true
+	}
+	profile := n.profile(from, to)
+	if profile.Drop > 0 && n.rng.Float64() < profile.Drop {
+		return 0, true
+	}
+	delay = n.sampleDelay(profile)
+	if profile.Bandwidth > 0 {
+		// the message waits for the link, then takes size/bandwidth to transmit
+		now := time.Now()
+		start := now
+		if n.busyUntil[to].After(now) {
+			start = n.busyUntil[to]
+		}
+		transmit := time.Duration(float64(size) / float64(profile.Bandwidth) * float64(time.Second))
+		n.busyUntil[to] = start.Add(transmit)
+		delay += start.Sub(now) + transmit
+	}
+	return delay, false
+}
+
+func (p *ProtocolState) SetNetem(config NetemConfig, rtv *int) error {
+	// sets the fault injection on the messages the node sends, an empty config turns it off
+	if err := config.validate(); err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if config.Default == (LinkProfile{}) && len(config.Links) == 0 && len(config.Partitions) == 0 {
+		p.netem = nil
+		return nil
+	}
+	p.netem = newNetem(config, p.MyId.Address)
+	return nil
+}
+
+// emulate holds a message back as the emulated link would, it returns false if the message is lost.
+// A lost message counts in NetemDropped, not as sent.
+func (p *ProtocolState) emulate(addr string, size int) bool {
+	p.lock.RLock()
+	n := p.netem
+	round := p.Round
+	p.lock.RUnlock()
+	if n == nil {
+		return true
+	}
+	delay, drop := n.shape(p.MyId.Address, addr, size, round)
+	if drop {
+		p.lock.Lock()
+		p.NetemDropped++
+		p.lock.Unlock()
+		return false
+	}
+	time.Sleep(delay)
+	return true
+}
@@ -0,0 +1,119 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNetem_partition(t *testing.T) {
+	config := NetemConfig{Partitions: []Partition{{Groups: [][]string{{"a", "b"}, {"c"}}, From: 2, To: 5}}}
+	n := newNetem(config, "a")
+	cases := []struct {
+		to    string
+		round int
+		drop  bool
+	}{
+		{"c", 1, false},
+		{"c", 2, true},
+		{"c", 4, true},
+		{"c", 5, false}, // healed
+		{"b", 3, false}, // same group
+		{"d", 3, false}, // in no group
+	}
+	for _, c := range cases {
+		if _, drop := n.shape("a", c.to, 100, c.round); drop != c.drop {
+			t.Errorf("a to %s at round %d: drop %t, expected %t", c.to, c.round, drop, c.drop)
+		}
+	}
+}
+
+func TestNetem_drop(t *testing.T) {
+	config := NetemConfig{Seed: 1, Default: LinkProfile{Drop: 0.3}, Links: []LinkRule{{To: "b", Profile: LinkProfile{}}}}
+	n := newNetem(config, "a")
+	dropped := 0
+	for i := 0; i < 10000; i++ {
+		if _, drop := n.shape("a", "c", 100, 0); drop {
+			dropped++
+		}
+		if _, drop := n.shape("a", "b", 100, 0); drop {
+			t.Fatalf("the rule for b is lossless")
+		}
+	}
+	if math.Abs(float64(dropped)/10000-0.3) > 0.02 {
+		t.Errorf("dropped %d of 10000 at 0.3", dropped)
+	}
+	// the same seed draws the same sequence
+	first, second := newNetem(config, "a"), newNetem(config, "a")
+	for i := 0; i < 100; i++ {
+		_, a := first.shape("a", "c", 100, 0)
+		_, b := second.shape("a", "c", 100, 0)
+		if a != b {
+			t.Fatalf("same seed, different drops")
+		}
+	}
+}
+
+func TestNetem_dropNotSent(t *testing.T) {
+	var p ProtocolState
+	p.MyId.Address = "a:1"
+	p.netem = newNetem(NetemConfig{Default: LinkProfile{Drop: 1}}, p.MyId.Address)
+	m := message.Message{Type: "Sample View", Sender: p.MyId}
+	if err := p.sendMsgToPeerWithTrial(m, "b:2", 1); err != nil {
+		t.Fatalf("a lost message is reported to the sender: %s", err)
+	}
+	if p.MsgCount != 0 || p.ByteCount != 0 || p.FailToSend != 0 || p.NetemDropped != 1 {
+		t.Errorf("lost message counted as sent %d, failed %d, dropped %d", p.MsgCount, p.FailToSend, p.NetemDropped)
+	}
+}
+
+func TestNetem_delay(t *testing.T) {
+	config := NetemConfig{Default: LinkProfile{Delay: 10 * time.Millisecond, Bandwidth: 1000}}
+	n := newNetem(config, "a")
+	delay, _ := n.shape("a", "b", 100, 0)
+	if delay < 110*time.Millisecond || delay > 115*time.Millisecond {
+		t.Errorf("100 bytes at 1000 B/s after 10ms: %s", delay)
+	}
+	// the second message waits for the first to be transmitted
+	delay, _ = n.shape("a", "b", 100, 0)
+	if delay < 205*time.Millisecond {
+		t.Errorf("queued message delayed %s", delay)
+	}
+	// jitter never makes the delay negative
+	n = newNetem(NetemConfig{Default: LinkProfile{Delay: time.Millisecond, Jitter: time.Second, Distribution: DELAY_NORMAL}}, "a")
+	for i := 0; i < 1000; i++ {
+		if delay, _ = n.shape("a", "b", 100, 0); delay < 0 {
+			t.Fatalf("negative delay %s", delay)
+		}
+	}
+}
+
+func TestNetemConfig(t *testing.T) {
+	config := NetemConfig{}
+	data := `{"seed": 3, "default": {"delay": "20ms", "jitter": "5ms", "distribution": "uniform", "drop": 0.01},
+		"links": [{"from": "a", "to": "", "profile": {"bandwidth": 1000}}],
+		"partitions": [{"groups": [["a"], ["b"]], "from": 3, "to": 6}]}`
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Default.Delay != 20*time.Millisecond || config.Default.Jitter != 5*time.Millisecond ||
+		config.Links[0].Profile.Bandwidth != 1000 || config.Partitions[0].To != 6 {
+		t.Errorf("config read as %+v", config)
+	}
+	if err := config.validate(); err != nil {
+		t.Error(err)
+	}
+	invalid := []NetemConfig{
+		{Default: LinkProfile{Distribution: "pareto"}},
+		{Default: LinkProfile{Drop: 1.5}},
+		{Links: []LinkRule{{Profile: LinkProfile{Delay: -time.Second}}}},
+		{Partitions: []Partition{{From: 5, To: 2}}},
+	}
+	for _, c := range invalid {
+		if err := c.validate(); err == nil {
+			t.Errorf("%+v accepted", c)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package algorithm
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ProbeParams describes a network measurement from a node to every peer of its initView
+type ProbeParams struct {
+	Sizes    []int         // payload sizes in bytes, every size is measured on its own
+	Samples  int           // round trips per peer and size
+	Interval time.Duration // pause between the samples to the same peer
+	Timeout  time.Duration // a round trip longer than this counts as lost
+}
+
+var DefaultProbeParams = ProbeParams{
+	Sizes:    []int{64, 2000, 16000},
+	Samples:  10,
+	Interval: 20 * time.Millisecond,
+	Timeout:  time.Second,
+}
+
+// LinkStats is the round trip distribution from one node to another for one payload size
+type LinkStats struct {
+	From   string
+	To     string
+	Size   int
+	Sent   int
+	Lost   int
+	Min    time.Duration
+	Median time.Duration
+	P99    time.Duration
+	Mean   time.Duration
+}
+
+func (s *LinkStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Lost) / float64(s.Sent)
+}
+
+// ProbeReport is the result of a probe at one node
+type ProbeReport struct {
+	From  string
+	Links []LinkStats
+}
+
+func linkStats(from string, to string, size int, sent int, rtts []time.Duration) LinkStats {
+	stats := LinkStats{From: from, To: to, Size: size, Sent: sent, Lost: sent - len(rtts)}
+	if len(rtts) == 0 {
+		return stats
+	}
+	sorted := make([]time.Duration, len(rtts))
+	copy(sorted, rtts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, rtt := range sorted {
+		total += rtt
+	}
+	stats.Min = sorted[0]
+	stats.Median = percentile(sorted, 0.5)
+	stats.P99 = percentile(sorted, 0.99)
+	stats.Mean = total / time.Duration(len(sorted))
+	return stats
+}
+
+// roundTrip sends a payload of the size to the BlackHole of the peer
+func roundTrip(addr string, size int, timeout time.Duration) (time.Duration, error) {
+	data := make([]byte, size)
+	rand.Read(data)
+	startTime := time.Now()
+	err := RpcCall(addr, "ProtocolState.BlackHole", data, nil, timeout)
+	rtt := time.Since(startTime)
+	if err != nil {
+		return 0, err
+	}
+	if rtt > timeout {
+		return 0, fmt.Errorf("round trip to %s timed out", addr)
+	}
+	return rtt, nil
+}
+
+// probe measures every peer of the initView in parallel
+func (p *ProtocolState) probe(params ProbeParams) ProbeReport {
+	p.lock.RLock()
+	peers := make([]string, 0, len(p.initView))
+	for i, _ := range p.initView {
+		if p.initView[i].Address != p.MyId.Address {
+			peers = append(peers, p.initView[i].Address)
+		}
+	}
+	p.lock.RUnlock()
+
+	report := ProbeReport{From: p.MyId.Address}
+	localLock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, addr := range peers {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			for _, size := range params.Sizes {
+				rtts := make([]time.Duration, 0, params.Samples)
+				for i := 0; i < params.Samples; i++ {
+					if i > 0 {
+						time.Sleep(params.Interval)
+					}
+					if rtt, err := roundTrip(addr, size, params.Timeout); err == nil {
+						rtts = append(rtts, rtt)
+					}
+				}
+				stats := linkStats(p.MyId.Address, addr, size, params.Samples, rtts)
+				localLock.Lock()
+				report.Links = append(report.Links, stats)
+				localLock.Unlock()
+			}
+		}(addr)
+	}
+	wg.Wait()
+	return report
+}
+
+func (p *ProtocolState) Probe(params ProbeParams, report *ProbeReport) error {
+	// measures the links to the peers, and returns once all samples are taken
+	*report = p.probe(params)
+	return nil
+}
+
+// LatencyMatrix holds the measured links between all pairs of nodes
+type LatencyMatrix struct {
+	Measured time.Time
+	Links    []LinkStats
+}
+
+func NewLatencyMatrix() *LatencyMatrix {
+	return &LatencyMatrix{Measured: time.Now(), Links: make([]LinkStats, 0)}
+}
+
+func (m *LatencyMatrix) Add(report ProbeReport) {
+	m.Links = append(m.Links, report.Links...)
+}
+
+// Get returns the link from one node to another for the payload size
+func (m *LatencyMatrix) Get(from string, to string, size int) (LinkStats, bool) {
+	for _, link := range m.Links {
+		if link.From == from && link.To == to && link.Size == size {
+			return link, true
+		}
+	}
+	return LinkStats{}, false
+}
+
+// Sizes are the payload sizes measured
+func (m *LatencyMatrix) Sizes() []int {
+	seen := make(map[int]bool)
+	sizes := make([]int, 0)
+	for _, link := range m.Links {
+		if !seen[link.Size] {
+			seen[link.Size] = true
+			sizes = append(sizes, link.Size)
+		}
+	}
+	sort.Ints(sizes)
+	return sizes
+}
+
+// P99 is the q-th percentile over all links of their p99 round trips for the payload size,
+// lost links are left out
+func (m *LatencyMatrix) P99(size int, q float64) time.Duration {
+	p99s := make([]time.Duration, 0)
+	for _, link := range m.Links {
+		if link.Size == size && link.Sent > link.Lost {
+			p99s = append(p99s, link.P99)
+		}
+	}
+	sort.Slice(p99s, func(i, j int) bool { return p99s[i] < p99s[j] })
+	return percentile(p99s, q)
+}
+
+// Loss is the fraction of the samples lost over all links for the payload size
+func (m *LatencyMatrix) Loss(size int) float64 {
+	sent, lost := 0, 0
+	for _, link := range m.Links {
+		if link.Size == size {
+			sent += link.Sent
+			lost += link.Lost
+		}
+	}
+	if sent == 0 {
+		return 0
+	}
+	return float64(lost) / float64(sent)
+}
+
+func (m *LatencyMatrix) String() string {
+	s := fmt.Sprintf("Latency matrix of %d links, measured %s\n", len(m.Links), m.Measured.Format(time.RFC3339))
+	for _, size := range m.Sizes() {
+		s += fmt.Sprintf("%d bytes: median p99 %s, worst p99 %s, loss %f\n",
+			size, m.P99(size, 0.5), m.P99(size, 1), m.Loss(size))
+	}
+	return s
+}
+
+var latencyHeader = []string{"from", "to", "size", "sent", "lost", "min_us", "median_us", "p99_us", "mean_us"}
+
+// WriteCSV exports the links, one per line, with the round trips in microseconds
+func (m *LatencyMatrix) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write(latencyHeader)
+	for _, link := range m.Links {
+		writer.Write([]string{
+			link.From, link.To, strconv.Itoa(link.Size), strconv.Itoa(link.Sent), strconv.Itoa(link.Lost),
+			strconv.FormatInt(link.Min.Microseconds(), 10),
+			strconv.FormatInt(link.Median.Microseconds(), 10),
+			strconv.FormatInt(link.P99.Microseconds(), 10),
+			strconv.FormatInt(link.Mean.Microseconds(), 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadLatencyCSV reads a matrix written by WriteCSV
+func ReadLatencyCSV(r io.Reader) (*LatencyMatrix, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || len(records[0]) != len(latencyHeader) {
+		return nil, fmt.Errorf("not a latency matrix")
+	}
+	m := NewLatencyMatrix()
+	for line, record := range records[1:] {
+		values := make([]int64, len(record)-2)
+		for i, _ := range values {
+			values[i], err = strconv.ParseInt(record[i+2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line+2, err)
+			}
+		}
+		m.Links = append(m.Links, LinkStats{
+			From:   record[0],
+			To:     record[1],
+			Size:   int(values[0]),
+			Sent:   int(values[1]),
+			Lost:   int(values[2]),
+			Min:    time.Duration(values[3]) * time.Microsecond,
+			Median: time.Duration(values[4]) * time.Microsecond,
+			P99:    time.Duration(values[5]) * time.Microsecond,
+			Mean:   time.Duration(values[6]) * time.Microsecond,
+		})
+	}
+	return m, nil
+}
@@ -0,0 +1,65 @@
+package algorithm
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLinkStats(t *testing.T) {
+	rtts := make([]time.Duration, 0)
+	for i := 100; i >= 1; i-- {
+		rtts = append(rtts, time.Duration(i)*time.Millisecond)
+	}
+	stats := linkStats("a", "b", 64, 110, rtts)
+	if stats.Min != time.Millisecond || stats.Median != 50*time.Millisecond || stats.P99 != 99*time.Millisecond {
+		t.Errorf("wrong distribution: min %s, median %s, p99 %s", stats.Min, stats.Median, stats.P99)
+	}
+	if stats.Lost != 10 || stats.Loss() != 10.0/110.0 {
+		t.Errorf("wrong loss: %d, %f", stats.Lost, stats.Loss())
+	}
+	if lost := linkStats("a", "b", 64, 5, nil); lost.Loss() != 1 || lost.Median != 0 {
+		t.Errorf("wrong stats of a lost link: %+v", lost)
+	}
+}
+
+func TestLatencyMatrix_CSV(t *testing.T) {
+	m := NewLatencyMatrix()
+	m.Add(ProbeReport{"a", []LinkStats{
+		{From: "a", To: "b", Size: 64, Sent: 10, Lost: 1, Min: time.Millisecond, Median: 2 * time.Millisecond, P99: 5 * time.Millisecond, Mean: 3 * time.Millisecond},
+		{From: "a", To: "c", Size: 64, Sent: 10, Min: time.Millisecond, Median: 4 * time.Millisecond, P99: 9 * time.Millisecond, Mean: 3 * time.Millisecond},
+	}})
+	var buf bytes.Buffer
+	if err := m.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadLatencyCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, ok := read.Get("a", "b", 64)
+	if !ok || link != m.Links[0] {
+		t.Errorf("link not read back: %+v", link)
+	}
+	if read.P99(64, 1) != 9*time.Millisecond || read.Loss(64) != 0.05 {
+		t.Errorf("wrong summary: p99 %s, loss %f", read.P99(64, 1), read.Loss(64))
+	}
+}
+
+func TestProtocolState_probe(t *testing.T) {
+	peers := make([]ProtocolState, 2)
+	for i, _ := range peers {
+		peers[i].init()
+	}
+	peers[0].addToInitView(peers[0].MyId)
+	peers[0].addToInitView(peers[1].MyId)
+	report := peers[0].probe(ProbeParams{Sizes: []int{64, 2000}, Samples: 3, Timeout: time.Second})
+	if len(report.Links) != 2 {
+		t.Fatalf("wrong number of links: %d", len(report.Links))
+	}
+	for _, link := range report.Links {
+		if link.To != peers[1].MyId.Address || link.Lost != 0 || link.Min <= 0 {
+			t.Errorf("wrong link: %+v", link)
+		}
+	}
+}
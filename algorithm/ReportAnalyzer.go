@@ -1,53 +1,154 @@
 package algorithm
 
 import (
+	"RVR/message"
 	"fmt"
-	"math"
 	"sort"
+	"strings"
 	"time"
 )
 
 type Data struct {
 	states     []ProtocolState
 	setupParam ProtocolRPCSetupParams
+	malicious  map[uint64]bool // the ids the controller knows to be malicious, besides the nodes that marked themselves
 }
 
 func (data *Data) checkConsensus() bool {
-	if len(data.states) == 0 {
+	stats := data.consensusStats()
+	if stats.Agreement {
 		return true
 	}
+	// the nodes are compared with the majority view, not with the first node
+	majority := stats.Clusters[0].digest
+	for i, _ := range data.states {
+		if !data.states[i].Malicious && string(data.states[i].View.Digest()) != majority {
+			fmt.Printf("Not consensus count: %d\n", stats.Honest-len(stats.Clusters[0].Nodes))
+			print(data.states[i].String())
+			break
+		}
+	}
+	return false
+}
+
+// ViewCluster is the honest nodes holding the same view
+type ViewCluster struct {
+	Digest string // the first bytes of the view digest, in hex
+	Size   int    // ids in the view
+	Nodes  []string
+	digest string
+	view   message.View
+}
 
-	viewHashMap := make(map[uint64]bool, len(data.states[0].View))
-	for i, _ := range data.states[0].View {
-		viewHashMap[data.states[0].View[i]] = true
+// ConsensusStats compares the views of the honest nodes with the view most of them hold
+type ConsensusStats struct {
+	Honest            int
+	Clusters          []ViewCluster // the largest first, it holds the majority view
+	MajorityShare     float64       // fraction of the honest nodes holding the majority view
+	Agreement         bool          // every honest node holds the majority view
+	MeanDistance      float64       // Jaccard distance between the views of two honest nodes, averaged over the pairs
+	MaxDistance       float64
+	MissingHonest     int  // honest nodes left out of the majority view
+	IncludedMalicious int  // malicious nodes in the majority view
+	Valid             bool // the majority view holds every honest node and no malicious one
+}
+
+func jaccardDistance(a message.View, b message.View) float64 {
+	union := len(a.Union(b))
+	if union == 0 {
+		return 0
+	}
+	return 1 - float64(len(a.Intersect(b)))/float64(union)
+}
+
+func (data *Data) consensusStats() ConsensusStats {
+	stats := ConsensusStats{Agreement: true, Valid: true}
+	byDigest := make(map[string]*ViewCluster)
+	honest := make([]uint64, 0, len(data.states))
+	malicious := make(map[uint64]bool)
+	for id, known := range data.malicious {
+		if known {
+			malicious[id] = true
+		}
 	}
-	var lastWrongState *ProtocolState
-	wrong := 0
 	for i, _ := range data.states {
-		if data.states[i].Malicious{
+		state := &data.states[i]
+		if state.Malicious {
+			malicious[state.MyId.GetUUID()] = true
 			continue
 		}
-		if len(data.states[i].View) != len(data.states[0].View) {
-			lastWrongState = &data.states[i]
-			wrong++
-			continue
+		honest = append(honest, state.MyId.GetUUID())
+		digest := string(state.View.Digest())
+		cluster, ok := byDigest[digest]
+		if !ok {
+			short := []byte(digest)[:6]
+			cluster = &ViewCluster{Digest: fmt.Sprintf("%X", short), Size: len(state.View), digest: digest, view: state.View}
+			byDigest[digest] = cluster
 		}
-		for j, _ := range data.states[i].View {
-			_, ok := viewHashMap[data.states[i].View[j]]
-			if !ok {
-				lastWrongState = &data.states[i]
-				wrong++
-				break
+		cluster.Nodes = append(cluster.Nodes, state.MyId.Address)
+	}
+	stats.Honest = len(honest)
+	if stats.Honest == 0 {
+		return stats
+	}
+	for _, cluster := range byDigest {
+		sort.Strings(cluster.Nodes)
+		stats.Clusters = append(stats.Clusters, *cluster)
+	}
+	sort.Slice(stats.Clusters, func(i, j int) bool {
+		if len(stats.Clusters[i].Nodes) != len(stats.Clusters[j].Nodes) {
+			return len(stats.Clusters[i].Nodes) > len(stats.Clusters[j].Nodes)
+		}
+		return stats.Clusters[i].Digest < stats.Clusters[j].Digest
+	})
+	majority := stats.Clusters[0]
+	stats.MajorityShare = float64(len(majority.Nodes)) / float64(stats.Honest)
+	stats.Agreement = len(stats.Clusters) == 1
+
+	// the nodes of a cluster are at distance 0, so the pairs are weighted by cluster
+	pairs := float64(stats.Honest) * float64(stats.Honest-1) / 2
+	for i, _ := range stats.Clusters {
+		for j := i + 1; j < len(stats.Clusters); j++ {
+			d := jaccardDistance(stats.Clusters[i].view, stats.Clusters[j].view)
+			stats.MeanDistance += d * float64(len(stats.Clusters[i].Nodes)*len(stats.Clusters[j].Nodes)) / pairs
+			if d > stats.MaxDistance {
+				stats.MaxDistance = d
 			}
 		}
 	}
-	if(wrong > 0){
-		fmt.Printf("Not consensus count: %d\n", wrong)
-		print(lastWrongState.String())
-		return false
-	}else{
-		return true
+
+	for _, id := range honest {
+		if !majority.view.Contains(id) {
+			stats.MissingHonest++
+		}
+	}
+	for id, _ := range malicious {
+		if majority.view.Contains(id) {
+			stats.IncludedMalicious++
+		}
+	}
+	stats.Valid = stats.MissingHonest == 0 && stats.IncludedMalicious == 0
+	return stats
+}
+
+func (s ConsensusStats) String() string {
+	clusters := make([]string, 0, len(s.Clusters))
+	for i, cluster := range s.Clusters {
+		if i == 5 {
+			clusters = append(clusters, fmt.Sprintf("%d more", len(s.Clusters)-i))
+			break
+		}
+		clusters = append(clusters, fmt.Sprintf("%s (%d ids): %d nodes", cluster.Digest, cluster.Size, len(cluster.Nodes)))
 	}
+	return fmt.Sprintf("-----------------------\n"+
+		"Consensus over %d honest nodes:\n"+
+		"agreement: %t, majority view held by %f\n"+
+		"Jaccard distance between views: mean %f, max %f\n"+
+		"validity: %t, honest nodes missing: %d, malicious nodes included: %d\n"+
+		"views: %s\n"+
+		"-----------------------\n",
+		s.Honest, s.Agreement, s.MajorityShare, s.MeanDistance, s.MaxDistance,
+		s.Valid, s.MissingHonest, s.IncludedMalicious, strings.Join(clusters, ", "))
 }
 
 func (data *Data) checkFinished() bool {
@@ -59,55 +160,31 @@ func (data *Data) checkFinished() bool {
 	return true
 }
 
-type PingValueReport []int
-type durationSlice []time.Duration
-
-func (d durationSlice) Len() int {
-	return len(d)
-}
-
-func (d durationSlice) Swap(i, j int) {
-	d[i], d[j] = d[j], d[i]
-}
-
-func (d durationSlice) Less(i, j int) bool {
-	return d[i] < d[j]
-}
-
-func (data *Data) time(percentile float64) time.Duration {
-	if len(data.states) == 0 {
-		return 0;
-	}
+func (data *Data) time(q float64) time.Duration {
 	times := make([]time.Duration, len(data.states))
 	for i, _ := range data.states {
 		times[i] = data.states[i].FinishTime.Sub(data.states[i].StartTime)
 	}
-	sort.Sort(durationSlice(times))
-	return times[int(math.Floor(percentile*(float64(len(times))-0.51)))]
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return percentile(times, q)
 }
 
-func (data *Data) msgCount(percentile float64) int {
-	if len(data.states) == 0 {
-		return 0;
-	}
+func (data *Data) msgCount(q float64) int {
 	counts := make([]int, len(data.states))
 	for i, _ := range data.states {
 		counts[i] = data.states[i].MsgCount
 	}
-	sort.Sort(sort.IntSlice(counts))
-	return counts[int(math.Floor(percentile*(float64(len(counts))-0.51)))]
+	sort.Ints(counts)
+	return percentileInt(counts, q)
 }
 
-func (data *Data) byteCount(percentile float64) int {
-	if len(data.states) == 0 {
-		return 0;
-	}
+func (data *Data) byteCount(q float64) int {
 	counts := make([]int, len(data.states))
 	for i, _ := range data.states {
 		counts[i] = data.states[i].ByteCount
 	}
-	sort.Sort(sort.IntSlice(counts))
-	return counts[int(math.Floor(percentile*(float64(len(counts))-0.51)))]
+	sort.Ints(counts)
+	return percentileInt(counts, q)
 }
 
 func (d *Data) Report() (report string, fin bool, cons bool, round int) {
@@ -139,3 +216,226 @@ func (d *Data) Report() (report string, fin bool, cons bool, round int) {
 		round)
 	return report, fin, cons, round
 }
+
+// Summary is the report of a run, for report --json
+type Summary struct {
+	Nodes        int
+	Finished     bool
+	Consensus    bool
+	Round        int
+	Params       ProtocolRPCSetupParams
+	TimeMedian   time.Duration
+	TimeP90      time.Duration
+	MsgMedian    int
+	MsgP90       int
+	BytesMedian  int
+	BytesP90     int
+	Views        ConsensusStats
+	Elections    ElectionStats
+	Sample       SampleStats
+	Gossip       GossipStats
+	NetemDropped int
+	Span         time.Duration // from the first start to the last finish, in the controller's clock
+	StartSpread  time.Duration
+}
+
+func (d *Data) Summary() Summary {
+	_, fin, cons, round := d.Report()
+	summary := Summary{
+		Nodes:        len(d.states),
+		Finished:     fin,
+		Consensus:    cons,
+		Round:        round,
+		Params:       d.setupParam,
+		TimeMedian:   d.time(0.5),
+		TimeP90:      d.time(0.9),
+		MsgMedian:    d.msgCount(0.5),
+		MsgP90:       d.msgCount(0.9),
+		BytesMedian:  d.byteCount(0.5),
+		BytesP90:     d.byteCount(0.9),
+		Views:        d.consensusStats(),
+		Elections:    d.electionStats(),
+		Sample:       d.sampleStats(),
+		Gossip:       d.gossipStats(),
+		NetemDropped: d.netemDropped(),
+	}
+	summary.Span, summary.StartSpread = d.runSpan()
+	return summary
+}
+
+// ElectionStats summarises the election records of the honest nodes
+type ElectionStats struct {
+	Repetitions   int
+	Records       int
+	SuccessRate   float64        // fraction of records in which a leader is accepted
+	AgreementRate float64        // fraction of nodes agreeing with the most common leader, averaged over repetitions
+	SolvedCount   int            // number of records in which the node solved the puzzle
+	LeaderCount   map[uint64]int // number of repetitions in which a node is the most common leader
+}
+
+func (data *Data) electionStats() ElectionStats {
+	stats := ElectionStats{LeaderCount: make(map[uint64]int)}
+	succeeded := 0
+	agreement := 0.0
+	// the records are grouped by their repetition, a node that joined or recovered starts its history mid-run
+	byRepetition := make(map[int][]ElectionRecord)
+	for i, _ := range data.states {
+		if data.states[i].Malicious {
+			continue
+		}
+		for _, record := range data.states[i].ElectionHistory {
+			byRepetition[record.Repetition] = append(byRepetition[record.Repetition], record)
+		}
+	}
+	for _, records := range byRepetition {
+		votes := make(map[uint64]int)
+		for _, record := range records {
+			stats.Records++
+			if record.Solved {
+				stats.SolvedCount++
+			}
+			if record.Succeeded {
+				succeeded++
+				votes[record.Leader]++
+			}
+		}
+		stats.Repetitions++
+		var majority uint64
+		majorityVotes := 0
+		for leader, count := range votes {
+			if count > majorityVotes || (count == majorityVotes && leader < majority) {
+				majority, majorityVotes = leader, count
+			}
+		}
+		if majorityVotes > 0 {
+			stats.LeaderCount[majority]++
+		}
+		agreement += float64(majorityVotes) / float64(len(records))
+	}
+	if stats.Records > 0 {
+		stats.SuccessRate = float64(succeeded) / float64(stats.Records)
+	}
+	if stats.Repetitions > 0 {
+		stats.AgreementRate = agreement / float64(stats.Repetitions)
+	}
+	return stats
+}
+
+func (s ElectionStats) String() string {
+	leaders := make([]string, 0, len(s.LeaderCount))
+	for leader, count := range s.LeaderCount {
+		leaders = append(leaders, fmt.Sprintf("%X: %d", leader, count))
+	}
+	sort.Strings(leaders)
+	return fmt.Sprintf("-----------------------\n"+
+		"Election statistics over %d repetitions:\n"+
+		"success rate: %f\n"+
+		"leader agreement rate: %f\n"+
+		"puzzles solved: %d\n"+
+		"leader distribution: %s\n"+
+		"-----------------------\n",
+		s.Repetitions, s.SuccessRate, s.AgreementRate, s.SolvedCount, strings.Join(leaders, ", "))
+}
+
+// sampleStats sums up the sample counters of the honest nodes
+func (data *Data) sampleStats() SampleStats {
+	var total SampleStats
+	nodes := 0
+	for i, _ := range data.states {
+		if data.states[i].Malicious {
+			continue
+		}
+		s := data.states[i].SampleStats
+		total.ViewSent += s.ViewSent
+		total.NilSent += s.NilSent
+		total.ViewReceived += s.ViewReceived
+		total.NilReceived += s.NilReceived
+		total.ViewCounted += s.ViewCounted
+		total.Selected += s.Selected
+		total.Candidates += s.Candidates
+		total.TheoreticalRate += s.TheoreticalRate
+		total.SketchBytes += s.SketchBytes
+		total.FullBytes += s.FullBytes
+		total.FalsePositives += s.FalsePositives
+		total.NonMembers += s.NonMembers
+		nodes++
+	}
+	if nodes > 0 {
+		total.TheoreticalRate /= float64(nodes)
+	}
+	return total
+}
+
+// netemDropped is the number of messages lost to the fault injection, over all nodes
+func (data *Data) netemDropped() int {
+	dropped := 0
+	for i, _ := range data.states {
+		dropped += data.states[i].NetemDropped
+	}
+	return dropped
+}
+
+// gossipStats sums up the gossip counters of the honest nodes
+func (data *Data) gossipStats() GossipStats {
+	var total GossipStats
+	for i, _ := range data.states {
+		if data.states[i].Malicious {
+			continue
+		}
+		s := data.states[i].GossipStats
+		total.AdvertsSent += s.AdvertsSent
+		total.DeltasSent += s.DeltasSent
+		total.DeltasApplied += s.DeltasApplied
+		total.Fallbacks += s.Fallbacks
+		total.BytesSaved += s.BytesSaved
+	}
+	return total
+}
+
+// proposalReach is the fraction of honest nodes the leader's proposal reached, per repetition
+func (data *Data) proposalReach() []ConvergencePoint {
+	histories := make([][]RepetitionRecord, 0, len(data.states))
+	for i, _ := range data.states {
+		if !data.states[i].Malicious {
+			histories = append(histories, data.states[i].History)
+		}
+	}
+	return convergenceTrace(histories)
+}
+
+func reachString(trace []ConvergencePoint) string {
+	reach := make([]string, len(trace))
+	for i, point := range trace {
+		reach[i] = fmt.Sprintf("%.2f (%.1f hops)", point.ProposalReceived, point.MeanHops)
+	}
+	return strings.Join(reach, ", ")
+}
+
+// runSpan is the time from the first start to the last finish of the nodes, and the spread
+// of their starts, with the times aligned to the controller's clock
+func (data *Data) runSpan() (span time.Duration, startSpread time.Duration) {
+	if len(data.states) == 0 {
+		return 0, 0
+	}
+	first := data.states[0].aligned(data.states[0].StartTime)
+	lastStart, last := first, data.states[0].aligned(data.states[0].FinishTime)
+	for i, _ := range data.states {
+		start := data.states[i].aligned(data.states[i].StartTime)
+		finish := data.states[i].aligned(data.states[i].FinishTime)
+		if start.Before(first) {
+			first = start
+		}
+		if start.After(lastStart) {
+			lastStart = start
+		}
+		if finish.After(last) {
+			last = finish
+		}
+	}
+	return last.Sub(first), lastStart.Sub(first)
+}
+
+func (data *Data) spanString() string {
+	span, spread := data.runSpan()
+	return fmt.Sprintf("Run span (controller clock): %s, start spread: %s\n", span, spread)
+}
@@ -0,0 +1,156 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestData_electionStats(t *testing.T) {
+	states := make([]ProtocolState, 4)
+	leaders := [][]uint64{{1, 1, 1, 2}, {3, 3, 0, 3}}
+	for rep, row := range leaders {
+		for i, leader := range row {
+			states[i].ElectionHistory = append(states[i].ElectionHistory,
+				ElectionRecord{Repetition: rep, Leader: leader, Succeeded: leader != 0, Solved: i == 0})
+		}
+	}
+	data := Data{states, DefaultSetupParams, nil}
+	stats := data.electionStats()
+	if stats.Repetitions != 2 || stats.Records != 8 {
+		t.Errorf("wrong number of repetitions/records: %d/%d", stats.Repetitions, stats.Records)
+	}
+	if stats.SuccessRate != 7.0/8.0 {
+		t.Errorf("wrong success rate: %f", stats.SuccessRate)
+	}
+	if stats.AgreementRate != 0.75 {
+		t.Errorf("wrong agreement rate: %f", stats.AgreementRate)
+	}
+	if stats.SolvedCount != 2 || stats.LeaderCount[1] != 1 || stats.LeaderCount[3] != 1 {
+		t.Errorf("wrong leader distribution: %v", stats.LeaderCount)
+	}
+
+	// malicious nodes are not counted
+	states[3].Malicious = true
+	stats = data.electionStats()
+	if math.Abs(stats.AgreementRate-5.0/6.0) > 1e-9 {
+		t.Errorf("wrong agreement rate with malicious node: %f", stats.AgreementRate)
+	}
+
+	// a node that joined at the second repetition counts there, not in the first
+	states[3].Malicious = false
+	states[3].ElectionHistory = []ElectionRecord{{Repetition: 1, Leader: 3, Succeeded: true}}
+	stats = data.electionStats()
+	if stats.Repetitions != 2 || stats.Records != 7 || math.Abs(stats.AgreementRate-(1+0.75)/2) > 1e-9 {
+		t.Errorf("wrong stats with a joined node: %+v", stats)
+	}
+}
+
+func TestData_sampleStats(t *testing.T) {
+	states := make([]ProtocolState, 3)
+	for i, _ := range states {
+		states[i].SampleStats = SampleStats{ViewSent: 2, NilSent: 8, Selected: 2, Candidates: 10, TheoreticalRate: 0.2}
+	}
+	states[2].Malicious = true
+	data := Data{states, DefaultSetupParams, nil}
+	total := data.sampleStats()
+	if total.ViewSent != 4 || total.NilSent != 16 {
+		t.Errorf("wrong message counts: %d/%d", total.ViewSent, total.NilSent)
+	}
+	if math.Abs(total.RealisedRate()-0.2) > 1e-9 || math.Abs(total.TheoreticalRate-0.2) > 1e-9 {
+		t.Errorf("wrong sample rate: %f, s_u: %f", total.RealisedRate(), total.TheoreticalRate)
+	}
+}
+
+func TestData_proposalReach(t *testing.T) {
+	states := make([]ProtocolState, 5)
+	hops := [][]int{{0, 1, 2, -1, 0}, {0, 0, -1, -1, 1}}
+	for rep, row := range hops {
+		for i, h := range row {
+			states[i].History = append(states[i].History,
+				RepetitionRecord{Repetition: rep, ProposalReceived: h >= 0, ProposalHops: h})
+		}
+	}
+	states[4].Malicious = true
+	data := Data{states, DefaultSetupParams, nil}
+	reach := data.proposalReach()
+	if len(reach) != 2 {
+		t.Fatalf("wrong number of repetitions: %d", len(reach))
+	}
+	if reach[0].ProposalReceived != 0.75 || reach[1].ProposalReceived != 0.5 {
+		t.Errorf("wrong reach: %f, %f", reach[0].ProposalReceived, reach[1].ProposalReceived)
+	}
+	if reach[0].MeanHops != 1 || reach[1].MeanHops != 0 {
+		t.Errorf("wrong mean hops: %f, %f", reach[0].MeanHops, reach[1].MeanHops)
+	}
+}
+
+func TestData_Summary(t *testing.T) {
+	states := make([]ProtocolState, 3)
+	for i, _ := range states {
+		states[i].Finished = true
+		states[i].MsgCount = 10 * (i + 1)
+		states[i].NetemDropped = 2
+	}
+	data := Data{states, DefaultSetupParams, nil}
+	summary := data.Summary()
+	if summary.Nodes != 3 || !summary.Finished || !summary.Consensus || summary.MsgMedian != 20 || summary.NetemDropped != 6 {
+		t.Errorf("wrong summary: %+v", summary)
+	}
+	encoded, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := Summary{}
+	if err = json.Unmarshal(encoded, &decoded); err != nil || decoded.MsgP90 != summary.MsgP90 {
+		t.Errorf("summary does not survive json: %v", err)
+	}
+}
+
+func TestData_consensusStats(t *testing.T) {
+	states := make([]ProtocolState, 5)
+	ids := make([]uint64, len(states))
+	for i, _ := range states {
+		states[i].MyId = message.Identity{Address: fmt.Sprintf("n%d", i), Public_key: []byte{byte(i)}}
+		ids[i] = states[i].MyId.GetUUID()
+	}
+	states[4].Malicious = true
+	// the first node is the odd one out, the majority holds the honest nodes and the malicious one
+	states[0].View = message.NewView(ids[:2])
+	for i := 1; i < 4; i++ {
+		states[i].View = message.NewView(ids)
+	}
+	data := Data{states, DefaultSetupParams, nil}
+	stats := data.consensusStats()
+	if stats.Honest != 4 || len(stats.Clusters) != 2 || len(stats.Clusters[0].Nodes) != 3 || stats.Clusters[0].Size != 5 {
+		t.Fatalf("wrong clusters: %+v", stats)
+	}
+	if stats.Agreement || stats.MajorityShare != 0.75 || data.checkConsensus() {
+		t.Errorf("expected no agreement, majority share %f", stats.MajorityShare)
+	}
+	// 3 of the 6 pairs are at distance 1 - 2/5
+	if math.Abs(stats.MeanDistance-0.3) > 1e-9 || math.Abs(stats.MaxDistance-0.6) > 1e-9 {
+		t.Errorf("wrong Jaccard distances: mean %f, max %f", stats.MeanDistance, stats.MaxDistance)
+	}
+	if stats.Valid || stats.MissingHonest != 0 || stats.IncludedMalicious != 1 {
+		t.Errorf("wrong validity: %+v", stats)
+	}
+
+	// the controller skips the nodes it knows to be malicious, they count as excluded
+	for i := 0; i < 3; i++ {
+		states[i].View = message.NewView(ids[:3])
+	}
+	data = Data{states[:3], DefaultSetupParams, map[uint64]bool{ids[3]: true}}
+	stats = data.consensusStats()
+	if !stats.Agreement || stats.MeanDistance != 0 || !stats.Valid || !data.checkConsensus() {
+		t.Errorf("expected a valid consensus: %+v", stats)
+	}
+	for i := 0; i < 3; i++ {
+		states[i].View = message.NewView(ids[:4])
+	}
+	if stats = data.consensusStats(); !stats.Agreement || stats.Valid || stats.IncludedMalicious != 1 {
+		t.Errorf("expected the known malicious node to break validity: %+v", stats)
+	}
+}
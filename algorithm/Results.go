@@ -0,0 +1,107 @@
+package algorithm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RunRecord is a finished run as the controller saves it, with the snapshots of its honest nodes
+type RunRecord struct {
+	Saved          time.Time
+	Peers          int // registered, the malicious ones included
+	Malicious      int
+	Consensus      bool
+	ConsensusTime  time.Duration // from the start until the controller saw consensus, zero if it did not watch
+	ConsensusRound int
+	Summary        Summary
+	Nodes          []NodeStatus
+}
+
+// the file the controller appends its runs to, set by ConfigureResults
+var resultsFile string
+
+// ConfigureResults makes the controller append every finished run to dir/runs.jsonl
+func ConfigureResults(dir string) error {
+	if dir == "" {
+		resultsFile = ""
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	resultsFile = filepath.Join(dir, "runs.jsonl")
+	return nil
+}
+
+// saveRun gathers the nodes and appends the run to the results, if they are kept
+func (c *ControllerState) saveRun(consensusTime time.Duration, consensusRound int) error {
+	if resultsFile == "" {
+		return nil
+	}
+	states, err := c.gatherStates()
+	if err != nil {
+		return err
+	}
+	analysis := c.analysis(states)
+	run := RunRecord{
+		Saved:          time.Now(),
+		Summary:        analysis.Summary(),
+		ConsensusTime:  consensusTime,
+		ConsensusRound: consensusRound,
+		Nodes:          make([]NodeStatus, len(states)),
+	}
+	run.Consensus = run.Summary.Consensus
+	for i, _ := range states {
+		run.Nodes[i] = nodeStatus(states[i].MyId.Address, &states[i])
+	}
+	c.lock.RLock()
+	run.Peers = len(c.PeerList)
+	for _, malicious := range c.maliciousMap {
+		if malicious {
+			run.Malicious++
+		}
+	}
+	c.lock.RUnlock()
+
+	f, err := os.OpenFile(resultsFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(run)
+}
+
+// ReadRuns reads the runs saved by a controller
+func ReadRuns(r io.Reader) ([]RunRecord, error) {
+	runs := make([]RunRecord, 0)
+	err := readJSONLines(r, func(decode func(v interface{}) error) error {
+		run := RunRecord{}
+		if err := decode(&run); err != nil {
+			return err
+		}
+		runs = append(runs, run)
+		return nil
+	})
+	return runs, err
+}
+
+func readRunFiles(files []string) ([]RunRecord, error) {
+	all := make([]RunRecord, 0)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		runs, err := ReadRuns(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		all = append(all, runs...)
+	}
+	return all, nil
+}
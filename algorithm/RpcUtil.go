@@ -3,6 +3,7 @@ package algorithm
 import (
 	"bufio"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -68,12 +69,27 @@ func (c *gobServerCodec) Close() error {
 }
 
 func ListenRPC(portAddr string, worker interface{}, exitSignal chan bool) string {
+	addr, e := listenRPC(portAddr, worker, exitSignal)
+	if e != nil {
+		log.Fatal("Error: listen error:", e)
+	}
+	return addr
+}
+
+// listenRPC is ListenRPC returning the listen error, the listener is closed on exit,
+// so a recovering node can listen on the same port again
+func listenRPC(portAddr string, worker interface{}, exitSignal chan bool) (string, error) {
 	handler := rpc.NewServer()
 	handler.Register(worker)
 	l, e := net.Listen("tcp", portAddr)
 	if e != nil {
-		log.Fatal("Error: listen error:", e)
+		return "", e
 	}
+	go func() {
+		<-exitSignal
+		exitSignal <- true
+		l.Close()
+	}()
 	go func() {
 		defer l.Close()
 		defer func() {
@@ -91,6 +107,9 @@ func ListenRPC(portAddr string, worker interface{}, exitSignal chan bool) string
 			}
 
 			conn, err := l.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			if err != nil {
 				fmt.Printf("Error: accept rpc connection %s", err.Error())
 				continue
@@ -120,7 +139,7 @@ func ListenRPC(portAddr string, worker interface{}, exitSignal chan bool) string
 			}(conn)
 		}
 	}()
-	return l.Addr().String()
+	return l.Addr().String(), nil
 }
 
 type gobClientCodec struct {
@@ -153,11 +172,13 @@ func (c *gobClientCodec) Close() error {
 }
 
 func RpcCall(srv string, rpcname string, args interface{}, reply interface{}, timeout time.Duration) (ret error) {
+	start := time.Now()
 	defer func() {
 		if r := recover(); r != nil {
 			// fail gracefully
 			ret = fmt.Errorf("%s", r)
 		}
+		observeRPC(rpcname, start, ret)
 	}()
 
 	conn, err := net.DialTimeout("tcp", srv, timeout)
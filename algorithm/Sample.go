@@ -3,9 +3,7 @@ package algorithm
 import (
 	"crypto/rand"
 	"math"
-	"golang.org/x/crypto/sha3"
 	"RVR/message"
-	"bytes"
 	"fmt"
 	"sync"
 )
@@ -21,8 +19,117 @@ func sampleSketch(p *ProtocolState) (round int){
 	return round
 }
 
+// a commitment received in the commit phase, together with the round it is bound to
+type sampleCommitment struct {
+	value []byte
+	round int
+}
+
+// SampleStats counts the sample messages of a node over all repetitions
+type SampleStats struct {
+	ViewSent        int     // full views sent to selected peers
+	NilSent         int     // nil messages sent to the peers not selected
+	ViewReceived    int
+	NilReceived     int
+	ViewCounted     int     // received views selected by this node's nonce and thus scored
+	Selected        int     // peers selected to receive the full view
+	Candidates      int     // peers whose nonce is received, selected or not
+	TheoreticalRate float64 // s_u of the last repetition
+
+	// with SAMPLE_ENCODING_BLOOM, the bandwidth and the accuracy of the sketches sent
+	SketchBytes     int // bytes of the sketches sent
+	FullBytes       int // bytes the full views would have taken instead
+	FalsePositives  int // ids of the initview outside the view that the sketches report
+	NonMembers      int // ids of the initview outside the view, tested against the sketches
+}
+
+// RealisedRate is the fraction of candidates selected to receive the full view
+func (s *SampleStats) RealisedRate() float64 {
+	if s.Candidates == 0 {
+		return 0
+	}
+	return float64(s.Selected) / float64(s.Candidates)
+}
+
+func (s *SampleStats) String() string {
+	str := fmt.Sprintf("views sent: %d, nil sent: %d, views received: %d, nil received: %d, sample rate: %f (s_u: %f)",
+		s.ViewSent, s.NilSent, s.ViewReceived, s.NilReceived, s.RealisedRate(), s.TheoreticalRate)
+	if s.SketchBytes > 0 {
+		str += fmt.Sprintf(", sketch bytes: %d (full views: %d), false positive rate: %f",
+			s.SketchBytes, s.FullBytes, s.FalsePositiveRate())
+	}
+	return str
+}
+
+// FalsePositiveRate is the measured false positive rate of the sketches sent
+func (s *SampleStats) FalsePositiveRate() float64 {
+	if s.NonMembers == 0 {
+		return 0
+	}
+	return float64(s.FalsePositives) / float64(s.NonMembers)
+}
+
+const (
+	SAMPLE_ENCODING_FULL  = "full"  // Sample View carries the full view
+	SAMPLE_ENCODING_BLOOM = "bloom" // Sample View carries a bloom filter of the view
+)
+
+// sketchView encodes the view as a bloom filter, and measures its false positives against the initview
+func (p *ProtocolState) sketchView() (sketch []byte, falsePositives int, nonMembers int) {
+	filter := message.BloomFromView(p.View, p.bloomFPRate)
+	for uuid, _ := range p.idToAddrMap {
+		if !p.View.Contains(uuid) {
+			nonMembers++
+			if filter.Test(uuid) {
+				falsePositives++
+			}
+		}
+	}
+	return filter.Encode(), falsePositives, nonMembers
+}
+
+// viewOf returns the ids the sender's view holds, the sketched view is
+// resolved against the initview since views only hold members of it
+func (p *ProtocolState) viewOf(m *message.Message) message.View {
+	if len(m.Sketch) == 0 {
+		return m.View
+	}
+	filter, err := message.DecodeBloomFilter(m.Sketch)
+	if err != nil {
+		p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: malformed sketch")
+		return nil
+	}
+	ids := make([]uint64, 0)
+	for uuid, _ := range p.idToAddrMap {
+		if filter.Test(uuid) {
+			ids = append(ids, uuid)
+		}
+	}
+	return message.NewView(ids)
+}
+
+// sampleSelected tells whether the sender with senderNonce should send its view to
+// the receiver with receiverNonce, both sides evaluate the same hash
+func sampleSelected(receiverNonce []byte, senderNonce []byte, difficulty float64) bool {
+	return evalHashWithDifficulty(receiverNonce, senderNonce, difficulty)
+}
+
+// checkReveal verifies that the nonce revealed in m opens the commitment received from its sender
+func (p *ProtocolState) checkReveal(commitMap map[uint64]sampleCommitment, m *message.Message) bool {
+	com, ok := commitMap[m.Sender.GetUUID()]
+	if !ok {
+		p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: commitment not received")
+		return false
+	}
+	if !message.VerifyCommitment(com.value, m.Nonce, m.Sender.GetUUID(), com.round, p.session) {
+		p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: nonce not matching commited value")
+		return false
+	}
+	return true
+}
+
 func Sample(p *ProtocolState) map[uint64]float64{
-	<- p.ticker
+	p.tick()
 	p.lock.Lock()
 	p.Round++
 	p.lock.Unlock()
@@ -39,21 +146,20 @@ func Sample(p *ProtocolState) map[uint64]float64{
 	difficulty := sU
 	loweredDifficulty := difficulty * (1+p.f)
 
-	// line 3: send hash(c_u) to nodes in initview
-	commit := sha3.New256().Sum(nonce)
+	// line 3: send hash(c_u) to nodes in initview, the commitment is bound to the round it is sent in
 	msg := new(message.Message)
-	msg.Nonce = commit
 	msg.Type = "Sample Commitment"
 	sentList := make(map[string]bool)
 	localLock := sync.Mutex{}
 	for i := 0; i < p.l; i++ {
-		<-p.ticker
+		p.tick()
 
 		p.lock.Lock()
 		p.Round++
 		msg.Round = p.Round
 		p.lock.Unlock()
 		msg.Sender = p.MyId
+		msg.Nonce = message.Commit(nonce, p.MyId.GetUUID(), msg.Round, p.session)
 		msg.Sign(p.privateKey)
 
 
@@ -78,9 +184,9 @@ func Sample(p *ProtocolState) map[uint64]float64{
 	}
 
 	// line 4: receive the commitments for offset rounds
-	commitMap := make(map[uint64][]byte)
+	commitMap := make(map[uint64]sampleCommitment)
 	for i := 0; i < p.offset; i++ {
-		<-p.ticker
+		p.tick()
 		p.lock.Lock()
 		p.Round++
 		p.lock.Unlock()
@@ -93,15 +199,18 @@ func Sample(p *ProtocolState) map[uint64]float64{
 			continue
 		}
 		if _, ok := p.idToAddrMap[m.Sender.GetUUID()]; !ok {
-			print("Message invalid: Not from initview\n")
+			p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: Not from initview")
+			p.traceReceive(&m, TRACE_NOT_IN_INITVIEW)
 			continue
 		}
 
 		if m.Type != "Sample Commitment"{
-			fmt.Printf("Message invalid: Type mismatch, expecting %s, get %s\n", "Sample Commitment", m.Type )
+			p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: Type mismatch, expecting %s, get %s", "Sample Commitment", m.Type)
+			p.traceReceive(&m, TRACE_INVALID)
 			continue
 		}
-		commitMap[m.Sender.GetUUID()] = m.Nonce
+		commitMap[m.Sender.GetUUID()] = sampleCommitment{m.Nonce, m.Round}
+		p.traceReceive(&m, TRACE_COUNTED)
 	}
 	p.inQueue = bufferQueue
 	p.lock.Unlock()
@@ -111,7 +220,7 @@ func Sample(p *ProtocolState) map[uint64]float64{
 	msg.Type = "Sample Nonce"
 	sentList = make(map[string] bool)
 	for i := 0; i < p.l; i++ {
-		<-p.ticker
+		p.tick()
 
 		p.lock.Lock()
 		p.Round++
@@ -143,7 +252,7 @@ func Sample(p *ProtocolState) map[uint64]float64{
 
 	// line 6: wait for offset rounds
 	for i := 0; i < p.offset; i++ {
-		<-p.ticker
+		p.tick()
 		p.lock.Lock()
 		p.Round++
 		p.lock.Unlock()
@@ -160,49 +269,60 @@ func Sample(p *ProtocolState) map[uint64]float64{
 			continue
 		}
 		if _, ok := p.idToAddrMap[m.Sender.GetUUID()]; !ok {
-			print("Message invalid: Not from initview\n")
+			p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: Not from initview")
+			p.traceReceive(&m, TRACE_NOT_IN_INITVIEW)
 			continue
 		}
 
 		if m.Type != "Sample Nonce"{
-			fmt.Printf("Message invalid: Type mismatch, expecting %s, get %s\n", "Sample Nonce", m.Type )
+			p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: Type mismatch, expecting %s, get %s", "Sample Nonce", m.Type)
+			p.traceReceive(&m, TRACE_INVALID)
 			continue
 		}
 		if _, ok := received[m.Sender.GetUUID()]; ok{
-			// print("Message invalid: Duplicate message\n")
 			continue
 		}
 
-		if _, ok := commitMap[m.Sender.GetUUID()]; !ok{
-			print("Message invalid: commitment not received, from %s\n",m.Sender.Address)
-			continue
-		}
-
-		if com := commitMap[m.Sender.GetUUID()]; !bytes.Equal(sha3.New256().Sum(m.Nonce), com){
-			print("Message invalid: nonce not matching commited value\n")
+		if !p.checkReveal(commitMap, &m) {
+			p.traceReceive(&m, TRACE_INVALID)
 			continue
 		}
 		received[m.Sender.GetUUID()] = true
-		if evalHashWithDifficulty(m.Nonce, nonce, loweredDifficulty){
+		p.traceReceive(&m, TRACE_COUNTED)
+		if sampleSelected(m.Nonce, nonce, loweredDifficulty){
 			toSend = append(toSend, m.Sender)
 		}else{
 			toSendNull = append(toSendNull, m.Sender)
 		}
 
 	}
+	p.SampleStats.Selected += len(toSend)
+	p.SampleStats.Candidates += len(toSend) + len(toSendNull)
+	p.SampleStats.TheoreticalRate = sU
 	p.inQueue = bufferQueue
 	p.lock.Unlock()
 
-
+	// the selected peers receive the full view, the others only the revealed nonce
 	msg.Nonce = nonce
 	msg.View = p.View
+	if p.sampleEncoding == SAMPLE_ENCODING_BLOOM {
+		p.lock.RLock()
+		sketch, falsePositives, nonMembers := p.sketchView()
+		p.lock.RUnlock()
+		msg.View = nil
+		msg.Sketch = sketch
+		p.lock.Lock()
+		p.SampleStats.FalsePositives += falsePositives
+		p.SampleStats.NonMembers += nonMembers
+		p.lock.Unlock()
+	}
 	nilMsg := new(message.Message)
 	nilMsg.Nonce = nonce
 	msg.Type = "Sample View"
 	nilMsg.Type = "Sample Nil Message"
 	sentList = make(map[string] bool)
 	for i := 0; i < p.l; i++ {
-		<-p.ticker
+		p.tick()
 
 		p.lock.Lock()
 		p.Round++
@@ -229,6 +349,13 @@ func Sample(p *ProtocolState) map[uint64]float64{
 					localLock.Lock()
 					sentList[addr] = true
 					localLock.Unlock()
+					p.lock.Lock()
+					p.SampleStats.ViewSent++
+					if len(msg.Sketch) > 0 {
+						p.SampleStats.SketchBytes += len(msg.Sketch)
+						p.SampleStats.FullBytes += p.View.EncodedSize()
+					}
+					p.lock.Unlock()
 				}
 			}(id.Address)
 			//p.sendMsgToPeerAsync(*msg, id.Address)
@@ -242,20 +369,22 @@ func Sample(p *ProtocolState) map[uint64]float64{
 				}
 				localLock.Unlock()
 
-				err := p.sendMsgToPeerWithTrial(*msg, addr, 1)
+				err := p.sendMsgToPeerWithTrial(*nilMsg, addr, 1)
 				if err == nil{
 					localLock.Lock()
 					sentList[addr] = true
 					localLock.Unlock()
+					p.lock.Lock()
+					p.SampleStats.NilSent++
+					p.lock.Unlock()
 				}
 			}(id.Address)
-			//p.sendMsgToPeerAsync(*nilMsg, id.Address)
 		}
 	}
 
 	// line 9: wait for offset rounds
 	for i := 0; i < p.offset; i++ {
-		<-p.ticker
+		p.tick()
 		p.lock.Lock()
 		p.Round++
 		p.lock.Unlock()
@@ -274,34 +403,45 @@ func Sample(p *ProtocolState) map[uint64]float64{
 			continue
 		}
 		if _, ok := p.idToAddrMap[m.Sender.GetUUID()]; !ok {
-			print("Message invalid: Not from initview\n")
+			p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: Not from initview")
+			p.traceReceive(&m, TRACE_NOT_IN_INITVIEW)
 			continue
 		}
 
 		if !(m.Type == "Sample View"|| m.Type == "Sample Nil Message"){
-			fmt.Printf("Message invalid: Type mismatch, expecting %s, get %s\n", "Sample View", m.Type )
-			fmt.Printf("The message with Round %d is received in Round %d\n", m.Round, p.Round)
+			p.logFields(LEVEL_WARN, "message_invalid", map[string]interface{}{"msg_round": m.Round},
+				"Message invalid: Type mismatch, expecting %s, get %s\nThe message with Round %d is received in Round %d",
+				"Sample View", m.Type, m.Round, p.Round)
+			p.traceReceive(&m, TRACE_INVALID)
 			continue
 		}
 
 		if _, ok := received[m.Sender.GetUUID()]; ok{
-			// print("Message invalid: Duplicate message\n")
 			continue
 		}
 
-		if _, ok := commitMap[m.Sender.GetUUID()]; !ok{
-			print("Message invalid: commitment not received\n")
+		if !p.checkReveal(commitMap, &m) {
+			p.traceReceive(&m, TRACE_INVALID)
 			continue
 		}
-
-		if com := commitMap[m.Sender.GetUUID()]; !bytes.Equal(sha3.New256().Sum(m.Nonce), com){
-			print("Message invalid: nonce not matching commited value\n")
-			continue
+		selected := sampleSelected(nonce, m.Nonce, difficulty)
+		if m.Type == "Sample Nil Message" {
+			p.SampleStats.NilReceived++
+			if selected {
+				// the sender selects with a lowered difficulty, so it must have sent its view
+				p.logEvent(LEVEL_WARN, "message_invalid", "Message invalid: nil message from a sender that should send its view")
+				p.traceReceive(&m, TRACE_INVALID)
+				continue
+			}
+		} else {
+			p.SampleStats.ViewReceived++
 		}
 		sampleCount++
 		received[m.Sender.GetUUID()] = true
-		if evalHashWithDifficulty(nonce, m.Nonce, difficulty){
-			for _, id := range m.View{
+		p.traceReceive(&m, TRACE_COUNTED)
+		if selected && m.Type == "Sample View" {
+			p.SampleStats.ViewCounted++
+			for _, id := range p.viewOf(&m){
 				score[id] = score[id]+1
 			}
 		}
@@ -310,7 +450,8 @@ func Sample(p *ProtocolState) map[uint64]float64{
 	p.lock.Unlock()
 	sampleTarget := (1-4*p.g)/(1+p.f)*float64(len(p.initView))
 	if float64(sampleCount) < sampleTarget{
-		fmt.Printf("Sample Failed on Round: %d due to not enough Samples, target: %f, received: %d.\n", p.Round, sampleTarget, sampleCount)
+		p.logFields(LEVEL_WARN, "sample_failed", map[string]interface{}{"target": sampleTarget, "received": sampleCount},
+			"Sample Failed on Round: %d due to not enough Samples, target: %f, received: %d.", p.Round, sampleTarget, sampleCount)
 		return nil
 	}else{
 		for i, _ := range score{
@@ -3,7 +3,9 @@ package algorithm
 import (
 	"testing"
 	"math/rand"
+	crand "crypto/rand"
 	"fmt"
+	"RVR/message"
 )
 
 func TestSample(t *testing.T) {
@@ -75,3 +77,90 @@ func TestSample(t *testing.T) {
 	}
 	print("\n")
 }
+
+func TestSampleSelected(t *testing.T) {
+	difficulty := 0.2
+	trials := 5000
+	selected := 0
+	senderNonce := make([]byte, 32)
+	receiverNonce := make([]byte, 32)
+	for i := 0; i < trials; i++ {
+		crand.Read(senderNonce)
+		crand.Read(receiverNonce)
+		counted := sampleSelected(receiverNonce, senderNonce, difficulty)
+		if counted {
+			selected++
+		}
+		// once the receiver revealed its nonce, the sender cannot choose the outcome
+		for j := 0; j < 3; j++ {
+			if sampleSelected(append([]byte(nil), receiverNonce...), senderNonce, difficulty) != counted {
+				t.Fatal("the selection is not determined by the nonces")
+			}
+		}
+	}
+	rate := float64(selected) / float64(trials)
+	if rate < difficulty-0.03 || rate > difficulty+0.03 {
+		t.Errorf("selection rate %f deviates from the difficulty %f", rate, difficulty)
+	}
+}
+
+func TestProtocolState_checkReveal(t *testing.T) {
+	var p ProtocolState
+	p.session = 99
+	sender := message.Identity{Address: "b:2", Public_key: []byte("sender key")}
+	other := message.Identity{Address: "c:3", Public_key: []byte("other key")}
+	nonce := make([]byte, 32)
+	crand.Read(nonce)
+	commitMap := map[uint64]sampleCommitment{
+		sender.GetUUID(): {message.Commit(nonce, sender.GetUUID(), 7, p.session), 7},
+		// the other node committed with the sender's nonce, as if it copied the sender's commitment
+		other.GetUUID(): {message.Commit(nonce, sender.GetUUID(), 7, p.session), 7},
+	}
+	if !p.checkReveal(commitMap, &message.Message{Sender: sender, Nonce: nonce}) {
+		t.Fatal("the committed nonce is rejected")
+	}
+
+	wrongNonce := append([]byte(nil), nonce...)
+	wrongNonce[0] ^= 1
+	if p.checkReveal(commitMap, &message.Message{Sender: sender, Nonce: wrongNonce}) {
+		t.Error("a reveal with another nonce is accepted")
+	}
+	if p.checkReveal(commitMap, &message.Message{Sender: other, Nonce: nonce}) {
+		t.Error("a commitment bound to another sender is accepted")
+	}
+	stale := map[uint64]sampleCommitment{sender.GetUUID(): {message.Commit(nonce, sender.GetUUID(), 6, p.session), 7}}
+	if p.checkReveal(stale, &message.Message{Sender: sender, Nonce: nonce}) {
+		t.Error("a commitment of another round is accepted")
+	}
+	p.session = 100
+	if p.checkReveal(commitMap, &message.Message{Sender: sender, Nonce: nonce}) {
+		t.Error("a commitment of another session is accepted")
+	}
+	if p.checkReveal(map[uint64]sampleCommitment{}, &message.Message{Sender: sender, Nonce: nonce}) {
+		t.Error("a reveal without a commitment is accepted")
+	}
+}
+
+func TestSample_sketchView(t *testing.T) {
+	p := ProtocolState{idToAddrMap: make(map[uint64]string), bloomFPRate: 0.01}
+	ids := make([]uint64, 0)
+	for i := 0; i < 400; i++ {
+		uuid := rand.Uint64()
+		p.idToAddrMap[uuid] = fmt.Sprintf("peer %d", i)
+		if i%2 == 0 {
+			ids = append(ids, uuid)
+		}
+	}
+	p.View = message.NewView(ids)
+	sketch, falsePositives, nonMembers := p.sketchView()
+	if nonMembers != 200 {
+		t.Errorf("wrong number of non-members: %d", nonMembers)
+	}
+	resolved := p.viewOf(&message.Message{Sketch: sketch})
+	if !resolved.Intersect(p.View).Equal(p.View) {
+		t.Error("the sketched view misses members")
+	}
+	if len(resolved.Difference(p.View)) != falsePositives {
+		t.Errorf("false positives: %d resolved, %d measured", len(resolved.Difference(p.View)), falsePositives)
+	}
+}
@@ -0,0 +1,432 @@
+package algorithm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how long a spawn step waits for the nodes to register
+const SCENARIO_SPAWN_TIMEOUT = 2 * time.Minute
+
+// how often a wait step checks its condition
+const SCENARIO_POLL = 5 * time.Second
+
+// ScenarioStep is one line of a scenario: a command and its arguments
+type ScenarioStep struct {
+	Line    int
+	Command string
+	Args    []string
+}
+
+func (s *ScenarioStep) String() string {
+	return strings.TrimSpace(s.Command + " " + strings.Join(s.Args, " "))
+}
+
+// Scenario is a sequence of controller commands, waits and assertions, run without the console.
+// One step per line, # starts a comment:
+//
+//	spawn 50
+//	set round 300ms
+//	setup
+//	start
+//	wait round 20 5m
+//	partition 20 40 2
+//	wait finished 30m
+//	assert consensus
+type Scenario struct {
+	Name  string
+	Steps []ScenarioStep
+}
+
+// scenarioCommand checks the arguments of a step when the scenario is parsed, and runs it
+type scenarioCommand struct {
+	check func(args []string) error
+	run   func(c *ControllerState, args []string) error
+}
+
+// errAssertion marks a failed assertion, the scenario goes on after it
+type errAssertion struct {
+	reason string
+}
+
+func (e *errAssertion) Error() string {
+	return "assertion failed: " + e.reason
+}
+
+func argCount(min int, max int) func(args []string) error {
+	return func(args []string) error {
+		if len(args) < min || len(args) > max {
+			if min == max {
+				return fmt.Errorf("takes %d arguments", min)
+			}
+			return fmt.Errorf("takes %d to %d arguments", min, max)
+		}
+		return nil
+	}
+}
+
+func positive(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s is not a positive number", arg)
+	}
+	return n, nil
+}
+
+var scenarioCommands = map[string]scenarioCommand{
+	"spawn": {
+		check: func(args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("takes the number of nodes")
+			}
+			_, err := positive(args[0])
+			return err
+		},
+		run: func(c *ControllerState, args []string) error {
+			count, _ := positive(args[0])
+			return c.spawnAndWait(count, SCENARIO_SPAWN_TIMEOUT)
+		},
+	},
+	"set": {
+		check: func(args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("takes a parameter and a value")
+			}
+			params := DefaultSetupParams
+			return setParam(&params, args[0], args[1])
+		},
+		run: func(c *ControllerState, args []string) error {
+			params := c.setupParams()
+			if err := setParam(&params, args[0], args[1]); err != nil {
+				return err
+			}
+			c.setSetupParams(params)
+			return nil
+		},
+	},
+	"setup": {
+		check: argCount(0, 0),
+		run: func(c *ControllerState, args []string) error {
+			return c.SetupProtocol(1, nil)
+		},
+	},
+	"start": {
+		check: argCount(0, 0),
+		run: func(c *ControllerState, args []string) error {
+			return c.StartProtocol(1, nil)
+		},
+	},
+	"wait": {
+		check: checkWait,
+		run:   runWait,
+	},
+	"netem": {
+		check: argCount(1, 1),
+		run: func(c *ControllerState, args []string) error {
+			if args[0] == "off" {
+				c.setNetem(NetemConfig{})
+				return nil
+			}
+			config, err := LoadNetemConfig(args[0])
+			if err != nil {
+				return err
+			}
+			c.setNetem(config)
+			return nil
+		},
+	},
+	"partition": {
+		check: func(args []string) error {
+			if len(args) != 3 {
+				return fmt.Errorf("takes the rounds it starts and heals at, and the number of groups")
+			}
+			from, err := strconv.Atoi(args[0])
+			if err != nil {
+				return err
+			}
+			to, err := strconv.Atoi(args[1])
+			if err != nil {
+				return err
+			}
+			if to < from {
+				return fmt.Errorf("heals at round %d before it starts at %d", to, from)
+			}
+			groups, err := positive(args[2])
+			if err == nil && groups < 2 {
+				return fmt.Errorf("needs at least 2 groups")
+			}
+			return err
+		},
+		run: func(c *ControllerState, args []string) error {
+			from, _ := strconv.Atoi(args[0])
+			to, _ := strconv.Atoi(args[1])
+			groups, _ := positive(args[2])
+			c.partition(from, to, groups)
+			return nil
+		},
+	},
+	"join": {
+		check: func(args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("takes the number of nodes")
+			}
+			_, err := positive(args[0])
+			return err
+		},
+		run: func(c *ControllerState, args []string) error {
+			count, _ := positive(args[0])
+			c.join(count)
+			return nil
+		},
+	},
+	"leave": {
+		check: func(args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("takes the number of nodes")
+			}
+			_, err := positive(args[0])
+			return err
+		},
+		run: func(c *ControllerState, args []string) error {
+			count, _ := positive(args[0])
+			c.leave(count)
+			return nil
+		},
+	},
+	"report": {
+		check: argCount(0, 0),
+		run: func(c *ControllerState, args []string) error {
+			fmt.Printf("%s", c.fullReport())
+			// a run that cannot be saved, with a node down, does not abort the scenario
+			if err := c.saveRun(0, 0); err != nil {
+				fmt.Printf("Scenario: unable to save the run: %s\n", err)
+			}
+			return nil
+		},
+	},
+	"reset": {
+		check: argCount(0, 0),
+		run: func(c *ControllerState, args []string) error {
+			return c.KillNodes(1, nil)
+		},
+	},
+	"assert": {
+		check: checkAssert,
+		run:   runAssert,
+	},
+}
+
+// wait DURATION | wait finished TIMEOUT | wait consensus TIMEOUT | wait round N TIMEOUT
+func checkWait(args []string) error {
+	if len(args) == 1 {
+		_, err := time.ParseDuration(args[0])
+		return err
+	}
+	switch {
+	case len(args) == 2 && (args[0] == "finished" || args[0] == "consensus"):
+		_, err := time.ParseDuration(args[1])
+		return err
+	case len(args) == 3 && args[0] == "round":
+		if _, err := positive(args[1]); err != nil {
+			return err
+		}
+		_, err := time.ParseDuration(args[2])
+		return err
+	}
+	return fmt.Errorf("takes a duration, or finished/consensus/round N and a timeout")
+}
+
+func runWait(c *ControllerState, args []string) error {
+	if len(args) == 1 {
+		duration, _ := time.ParseDuration(args[0])
+		time.Sleep(duration)
+		return nil
+	}
+	timeout, _ := time.ParseDuration(args[len(args)-1])
+	deadline := time.Now().Add(timeout)
+	for {
+		var done bool
+		switch args[0] {
+		case "finished":
+			_, done, _, _ = c.report()
+		case "consensus":
+			_, _, done, _ = c.report()
+		case "round":
+			round, _ := positive(args[1])
+			done = c.lowestRound() >= round
+		}
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		time.Sleep(SCENARIO_POLL)
+	}
+}
+
+// assert consensus [within ROUNDS] | assert finished
+func checkAssert(args []string) error {
+	switch {
+	case len(args) == 1 && (args[0] == "consensus" || args[0] == "finished"):
+		return nil
+	case len(args) == 3 && args[0] == "consensus" && args[1] == "within":
+		_, err := positive(args[2])
+		return err
+	}
+	return fmt.Errorf("takes consensus [within ROUNDS] or finished")
+}
+
+func runAssert(c *ControllerState, args []string) error {
+	report, fin, cons, _ := c.report()
+	switch {
+	case args[0] == "finished" && !fin:
+		return &errAssertion{"not finished: " + strings.TrimSpace(report)}
+	case args[0] == "consensus" && !cons:
+		return &errAssertion{"no consensus: " + strings.TrimSpace(report)}
+	case len(args) == 3:
+		// the round the honest views first agreed at, not the round the nodes are at now
+		rounds, _ := positive(args[2])
+		round := agreementRound(convergenceTrace(c.gatherHistories()))
+		if round < 0 {
+			return &errAssertion{"no agreement in the histories of the honest nodes"}
+		}
+		if round > rounds {
+			return &errAssertion{fmt.Sprintf("consensus at round %d, later than %d", round, rounds)}
+		}
+	}
+	return nil
+}
+
+// ParseScenario reads a scenario, and checks the arguments of every step
+func ParseScenario(r io.Reader, name string) (*Scenario, error) {
+	scenario := Scenario{Name: name, Steps: make([]ScenarioStep, 0)}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		step := ScenarioStep{Line: line, Command: fields[0], Args: fields[1:]}
+		command, ok := scenarioCommands[step.Command]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: unknown command %s", name, line, step.Command)
+		}
+		if err := command.check(step.Args); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s %s", name, line, step.Command, err)
+		}
+		scenario.Steps = append(scenario.Steps, step)
+	}
+	return &scenario, scanner.Err()
+}
+
+func LoadScenario(file string) (*Scenario, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseScenario(f, file)
+}
+
+// RunScenario runs the steps in order. A failed assertion is counted and the scenario goes on,
+// any other failed step stops it.
+func (c *ControllerState) RunScenario(scenario *Scenario) (failed int, err error) {
+	for _, step := range scenario.Steps {
+		fmt.Printf("Scenario: %s:%d: %s\n", scenario.Name, step.Line, step.String())
+		err = scenarioCommands[step.Command].run(c, step.Args)
+		if assertion, ok := err.(*errAssertion); ok {
+			fmt.Printf("Scenario: %s:%d: %s\n", scenario.Name, step.Line, assertion)
+			failed++
+			continue
+		}
+		if err != nil {
+			return failed, fmt.Errorf("%s:%d: %s: %s", scenario.Name, step.Line, step.Command, err)
+		}
+	}
+	fmt.Printf("Scenario: %s done, %d assertions failed\n", scenario.Name, failed)
+	return failed, nil
+}
+
+// spawnAndWait spawns the nodes on the spawners, and waits until they registered
+func (c *ControllerState) spawnAndWait(count int, timeout time.Duration) error {
+	c.lock.Lock()
+	if len(c.ServerList) == 0 {
+		c.ServerList = SPAWNER_LIST
+		fmt.Printf("default spawners loaded.\n")
+	}
+	target := len(c.PeerList) + count
+	c.lock.Unlock()
+	c.spawnEvenly(count)
+	deadline := time.Now().Add(timeout)
+	for {
+		c.lock.RLock()
+		registered := len(c.PeerList)
+		c.lock.RUnlock()
+		if registered >= target {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d of %d nodes registered", registered, target)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// lowestRound is the round of the slowest honest node, -1 if some node did not reply or none is honest
+func (c *ControllerState) lowestRound() int {
+	states, err := c.gatherStates()
+	if err != nil || len(states) == 0 {
+		return -1
+	}
+	lowest := -1
+	for i, _ := range states {
+		if states[i].Malicious {
+			continue
+		}
+		if lowest < 0 || states[i].Round < lowest {
+			lowest = states[i].Round
+		}
+	}
+	return lowest
+}
+
+// partition cuts the peers into random groups from round from until round to,
+// on top of the fault injection already set
+func (c *ControllerState) partition(from int, to int, groups int) {
+	c.lock.RLock()
+	cut := Partition{Groups: make([][]string, groups), From: from, To: to}
+	for i, j := range rand.Perm(len(c.PeerList)) {
+		cut.Groups[i%groups] = append(cut.Groups[i%groups], c.PeerList[j].Address)
+	}
+	config := c.netem
+	c.lock.RUnlock()
+	config.Partitions = append(append([]Partition{}, config.Partitions...), cut)
+	c.setNetem(config)
+}
+
+// StartScenario runs the controller without the console, for the scenario in the file
+func StartScenario(file string, exitSignal chan bool) (failed int, err error) {
+	scenario, err := LoadScenario(file)
+	if err != nil {
+		return 0, err
+	}
+	c := ControllerState{}
+	c.ExitSignal = exitSignal
+	c.SetupParams = DefaultSetupParams
+	c.listen()
+	defer c.KillNodes(1, nil)
+	return c.RunScenario(scenario)
+}
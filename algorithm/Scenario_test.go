@@ -0,0 +1,52 @@
+package algorithm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseScenario(t *testing.T) {
+	text := `# a partition that heals
+spawn 50
+set round 300ms   # shorter rounds
+set gossip delta
+setup
+start
+
+wait round 20 5m
+partition 20 40 2
+wait finished 30m
+assert consensus within 200
+`
+	scenario, err := ParseScenario(strings.NewReader(text), "partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenario.Steps) != 9 {
+		t.Fatalf("%d steps", len(scenario.Steps))
+	}
+	step := scenario.Steps[1]
+	if step.Line != 3 || step.Command != "set" || step.String() != "set round 300ms" {
+		t.Errorf("step read as %+v", step)
+	}
+
+	invalid := map[string]string{
+		"spawn":             "takes the number of nodes",
+		"spawn -3":          "not a positive number",
+		"set round fast":    "invalid duration",
+		"set rounds 3":      "unknown parameter",
+		"wait":              "takes a duration",
+		"wait round 10":     "takes a duration",
+		"partition 40 20 2": "heals at round 20",
+		"partition 20 40 1": "at least 2 groups",
+		"assert agreement":  "takes consensus",
+		"setup now":         "takes 0 arguments",
+		"launch":            "unknown command",
+	}
+	for line, reason := range invalid {
+		_, err := ParseScenario(strings.NewReader("setup\n"+line), "invalid")
+		if err == nil || !strings.Contains(err.Error(), reason) || !strings.HasPrefix(err.Error(), "invalid:2:") {
+			t.Errorf("%s: %v", line, err)
+		}
+	}
+}
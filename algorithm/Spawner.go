@@ -9,6 +9,8 @@ import (
 type SpawnerState struct {
 	ControlAddress string
 	ExitSignal     chan bool
+	CheckpointDir  string // the nodes save their checkpoints here if set
+	Restart        bool   // restart crashed nodes from their checkpoints
 }
 
 var SPAWNER_LIST  = []string {"xcna0.comp.nus.edu.sg:9697",
@@ -196,14 +198,19 @@ func (s *SpawnerState) Spawn(count int, rtv *int) error {
 				}
 			}()
 			_exitSignal := make(chan bool, 5)
-			node := StartNode(s.ControlAddress, _exitSignal)
+			node := StartCheckpointedNode(s.ControlAddress, s.CheckpointDir, _exitSignal)
 			for{
 				time.Sleep(20 * time.Second)
 				select{
 				case <-_exitSignal:
 					_exitSignal <- true
 					fmt.Printf("%s: node exiting\n", node.MyId.Address)
-					return
+					processMetrics.untrackNode(node)
+					node.closeLogs()
+					if node = s.restart(node); node == nil {
+						return
+					}
+					_exitSignal = node.ExitSignal
 				}
 			}
 		}()
@@ -211,6 +218,24 @@ func (s *SpawnerState) Spawn(count int, rtv *int) error {
 	return nil
 }
 
+// restart recovers a crashed node from its checkpoint, it returns nil if the node is not restarted
+func (s *SpawnerState) restart(node *ProtocolState) *ProtocolState {
+	node.lock.RLock()
+	crashed := node.crashed
+	node.lock.RUnlock()
+	if !s.Restart || !crashed || s.CheckpointDir == "" {
+		return nil
+	}
+	file := checkpointFile(s.CheckpointDir, &node.MyId)
+	recovered, err := RecoverNode(s.ControlAddress, file, make(chan bool, 5))
+	if err != nil {
+		fmt.Printf("%s: unable to restart: %s\n", node.MyId.Address, err)
+		return nil
+	}
+	fmt.Printf("%s: node restarted\n", node.MyId.Address)
+	return recovered
+}
+
 func (s *SpawnerState) Exit(count int, rtv *int) error {
 	go func(term chan bool) { time.Sleep(100 * time.Microsecond); term <- true }(s.ExitSignal)
 	return nil
@@ -229,7 +254,13 @@ func (s *SpawnerState) Start() {
 }
 
 func StartSpawner(controlAddr string, exitSignal chan bool) {
-	server := SpawnerState{ControlAddress: controlAddr, ExitSignal: exitSignal}
+	StartRestartingSpawner(controlAddr, "", false, exitSignal)
+}
+
+// StartRestartingSpawner starts a spawner whose nodes checkpoint to the directory,
+// and with restart set, crashed nodes are recovered from their checkpoints
+func StartRestartingSpawner(controlAddr string, checkpointDir string, restart bool, exitSignal chan bool) {
+	server := SpawnerState{ControlAddress: controlAddr, ExitSignal: exitSignal, CheckpointDir: checkpointDir, Restart: restart}
 	server.Start()
 }
 
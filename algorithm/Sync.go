@@ -0,0 +1,149 @@
+package algorithm
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the fewest distinct senders a catch-up is decided on
+const DRIFT_MIN_SENDERS = 8
+
+// roundDrift estimates how far the peers are ahead of the node, from the latest round each of them sent.
+// It has its own lock, SendInMsg updates it while holding p.lock; the node holds it by pointer,
+// so the copies of the state do not copy the lock.
+type roundDrift struct {
+	lock       sync.Mutex
+	rounds     map[uint64]int // the latest round of a message, by sender
+	lag        int            // rounds to run without waiting for the ticker
+	repetition int            // the repetition skipped counts for
+	skipped    int            // rounds scheduled to skip in this repetition
+}
+
+// resetDrift starts a fresh estimate, at the setup of the node
+func (p *ProtocolState) resetDrift() {
+	if p.drift == nil {
+		p.drift = new(roundDrift)
+	}
+	p.drift.reset()
+}
+
+func (d *roundDrift) reset() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.rounds = make(map[uint64]int)
+	d.lag = 0
+	d.repetition = 0
+	d.skipped = 0
+}
+
+func (d *roundDrift) observe(sender uint64, round int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.rounds == nil {
+		d.rounds = make(map[uint64]int)
+	}
+	if latest, ok := d.rounds[sender]; !ok || round > latest {
+		d.rounds[sender] = round
+	}
+}
+
+// estimate is the median over the senders of how far ahead of current they are,
+// ok is false with too few senders, so that a single peer cannot move it
+func (d *roundDrift) estimate(current int) (drift int, ok bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.rounds) < DRIFT_MIN_SENDERS {
+		return 0, false
+	}
+	diffs := make([]int, 0, len(d.rounds))
+	for _, round := range d.rounds {
+		diffs = append(diffs, round-current)
+	}
+	sort.Ints(diffs)
+	return diffs[len(diffs)/2], true
+}
+
+// catchUp schedules the rounds to skip, at most budget rounds per repetition.
+// lagging is false once the budget is spent, the node then checks its peers as usual.
+func (d *roundDrift) catchUp(rounds int, repetition int, budget int) (scheduled bool, lagging bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.lag > 0 {
+		return false, true
+	}
+	if repetition != d.repetition {
+		d.repetition, d.skipped = repetition, 0
+	}
+	if rounds > budget-d.skipped {
+		rounds = budget - d.skipped
+	}
+	if rounds <= 0 {
+		return false, false
+	}
+	d.lag = rounds
+	d.skipped += rounds
+	return true, true
+}
+
+func (d *roundDrift) skip() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.lag > 0 {
+		d.lag--
+		return true
+	}
+	return false
+}
+
+// tick waits for the next round; a lagging node runs its rounds without waiting until it caught up
+func (p *ProtocolState) tick() {
+	if p.drift.skip() {
+		p.lock.Lock()
+		p.CaughtUp++
+		p.lock.Unlock()
+		return
+	}
+	<-p.ticker
+}
+
+// observeRound takes the round of a received message into the drift estimate, and decides
+// whether the node lags behind its peers. The caller holds p.lock.
+func (p *ProtocolState) observeRound(sender uint64, msgType string, round int) (lagging bool) {
+	if p.CurrentProto == "Gossip" || strings.HasPrefix(msgType, "Gossip") {
+		// the round is held during Gossip
+		return false
+	}
+	p.drift.observe(sender, round)
+	drift, ok := p.drift.estimate(p.Round)
+	if !ok {
+		return false
+	}
+	p.Drift = drift
+	if drift <= p.offset/2 {
+		return false
+	}
+	scheduled, lagging := p.drift.catchUp(drift, p.Repetition, p.offset)
+	if scheduled {
+		p.CatchUps++
+	}
+	return lagging
+}
+
+func (p *ProtocolState) StartAt(at time.Time, rtv *int) error {
+	// starts the protocol at the agreed time, the rounds of all nodes tick in phase
+	// as far as the clock offsets are estimated right
+	p.lock.Lock()
+	p.startAt = at
+	p.lock.Unlock()
+	go func() {
+		// the time is in the controller's clock
+		time.Sleep(time.Until(at.Add(p.ClockOffset)))
+		p.lock.Lock()
+		p.ticker = time.Tick(p.roundDuration)
+		p.lock.Unlock()
+		p.launch()
+	}()
+	return nil
+}
@@ -0,0 +1,54 @@
+package algorithm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProtocolState_observeRound(t *testing.T) {
+	var p ProtocolState
+	p.offset = 8
+	p.Round = 10
+	p.resetDrift()
+	// a single fast peer is not enough to catch up, however many messages it sends
+	for i := 0; i < 100; i++ {
+		if p.observeRound(1, "Sample View", 20+i) {
+			t.Fatalf("caught up on a single fast peer")
+		}
+	}
+	// the peers are 6 rounds ahead
+	lagging := false
+	for sender := uint64(2); sender < 2+DRIFT_MIN_SENDERS; sender++ {
+		lagging = p.observeRound(sender, "Sample View", 16)
+	}
+	if !lagging || p.Drift != 6 || p.CatchUps != 1 {
+		t.Fatalf("lag not detected: drift %d, catch-ups %d", p.Drift, p.CatchUps)
+	}
+	// the lagging rounds run without waiting
+	p.ticker = time.Tick(time.Hour)
+	for i := 0; i < 6; i++ {
+		p.tick()
+	}
+	if p.CaughtUp != 6 {
+		t.Errorf("caught up %d rounds", p.CaughtUp)
+	}
+	// a repetition skips at most offset rounds, then the node no longer counts as lagging
+	if !p.observeRound(2, "Sample View", 40) || p.CatchUps != 2 {
+		t.Fatalf("the rest of the budget not used: catch-ups %d", p.CatchUps)
+	}
+	for i := 0; i < 2; i++ {
+		p.tick()
+	}
+	if p.CaughtUp != 8 || p.observeRound(3, "Sample View", 40) {
+		t.Errorf("caught up beyond the budget: %d rounds", p.CaughtUp)
+	}
+	p.Repetition++
+	if !p.observeRound(4, "Sample View", 40) || p.CatchUps != 3 {
+		t.Errorf("no catch-up in the next repetition")
+	}
+	// gossip rounds are held, they do not count
+	p.CurrentProto = "Gossip"
+	if p.observeRound(5, "Gossip Message", 100) {
+		t.Errorf("gossip round counted")
+	}
+}
@@ -0,0 +1,321 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the outcomes of a traced message, on the side of the sender then of the receiver
+const (
+	TRACE_SEND_FAILED     = "send_failed"
+	TRACE_DROPPED         = "dropped" // by the fault injection
+	TRACE_SENT            = "sent"
+	TRACE_EXPIRED         = "expired"
+	TRACE_INVALID         = "invalid"
+	TRACE_NOT_IN_INITVIEW = "not_in_initview"
+	TRACE_UNSYNCHRONIZED  = "unsynchronized"
+	TRACE_ACCEPTED        = "accepted"
+	TRACE_COUNTED         = "counted" // used by the protocol: a challenge in the Merkle tree, a sample counted, a valid solution
+)
+
+// how far a message went, a cell of a delivery matrix shows the furthest outcome
+var traceRank = map[string]int{
+	TRACE_SEND_FAILED:     0,
+	TRACE_DROPPED:         1,
+	TRACE_SENT:            2,
+	TRACE_EXPIRED:         3,
+	TRACE_INVALID:         3,
+	TRACE_NOT_IN_INITVIEW: 3,
+	TRACE_UNSYNCHRONIZED:  3,
+	TRACE_ACCEPTED:        4,
+	TRACE_COUNTED:         5,
+}
+
+var traceSymbol = map[string]string{
+	TRACE_SEND_FAILED:     "F",
+	TRACE_DROPPED:         "D",
+	TRACE_SENT:            "S",
+	TRACE_EXPIRED:         "E",
+	TRACE_INVALID:         "I",
+	TRACE_NOT_IN_INITVIEW: "N",
+	TRACE_UNSYNCHRONIZED:  "U",
+	TRACE_ACCEPTED:        "A",
+	TRACE_COUNTED:         "C",
+}
+
+// TraceRecord is a send or a receive of a message, written by the node that sent or received it
+type TraceRecord struct {
+	Time       time.Time `json:"time"`
+	Node       string    `json:"node"` // the address of the node that wrote the record
+	Session    uint64    `json:"session"`
+	Repetition int       `json:"repetition"`
+	Sender     string    `json:"sender"`
+	Receiver   string    `json:"receiver"`
+	Type       string    `json:"type"`
+	RoundSent  int       `json:"round_sent"`
+	Round      int       `json:"round"` // the round of the node that wrote the record
+	Outcome    string    `json:"outcome"`
+}
+
+// records waiting for the trace writer beyond this are dropped, the protocol does not wait for the trace
+const TRACE_BUFFER = 4096
+
+// the directory the nodes of the process write their traces to, set by ConfigureTrace before the nodes start
+var traceDir string
+
+// ConfigureTrace makes the nodes of the process trace every message they send and receive to a file in dir
+func ConfigureTrace(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	traceDir = dir
+	return nil
+}
+
+// openTrace opens the message trace of the node once it knows its identity
+func (p *ProtocolState) openTrace() {
+	if traceDir == "" {
+		return
+	}
+	file, err := newFileSink(filepath.Join(traceDir, fmt.Sprintf("%X.trace.jsonl", p.MyId.GetUUID())))
+	if err != nil {
+		fmt.Printf("%s: unable to open the message trace: %s\n", p.MyId.Address, err)
+		return
+	}
+	p.trace = newTraceSink(file)
+}
+
+// traceSink writes the records of a node to its file, on a goroutine of its own so the tracing
+// node never waits for the disk, with or without its lock
+type traceSink struct {
+	records chan TraceRecord
+	file    *fileSink
+	stop    chan bool
+	done    chan bool
+	stopped sync.Once
+}
+
+func newTraceSink(file *fileSink) *traceSink {
+	s := &traceSink{records: make(chan TraceRecord, TRACE_BUFFER), file: file, stop: make(chan bool), done: make(chan bool)}
+	go s.run()
+	return s
+}
+
+func (s *traceSink) write(record TraceRecord) {
+	select {
+	case s.records <- record:
+	default:
+		processMetrics.Add("rvr_trace_dropped_total", "trace records the trace writer could not keep up with", "", 1)
+	}
+}
+
+func (s *traceSink) run() {
+	defer close(s.done)
+	for {
+		select {
+		case record := <-s.records:
+			s.file.encode(record)
+		case <-s.stop:
+			for len(s.records) > 0 {
+				s.file.encode(<-s.records)
+			}
+			s.file.close()
+			return
+		}
+	}
+}
+
+// close writes the records still waiting and closes the file
+func (s *traceSink) close() {
+	s.stopped.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+// traceSend records the outcome of a message sent to addr, the caller does not hold the lock
+func (p *ProtocolState) traceSend(m *message.Message, addr string, outcome string) {
+	if p.trace == nil {
+		return
+	}
+	p.lock.RLock()
+	record := p.traceRecord(m, addr, outcome)
+	p.lock.RUnlock()
+	p.trace.write(record)
+}
+
+func sendOutcome(err error) string {
+	if err != nil {
+		return TRACE_SEND_FAILED
+	}
+	return TRACE_SENT
+}
+
+// traceReceive records what the node did with a message it received, the caller holds the lock
+func (p *ProtocolState) traceReceive(m *message.Message, outcome string) {
+	if p.trace == nil {
+		return
+	}
+	p.trace.write(p.traceRecord(m, p.MyId.Address, outcome))
+}
+
+// traceRecord reads the session, the repetition and the round of the node, the caller holds the lock
+func (p *ProtocolState) traceRecord(m *message.Message, receiver string, outcome string) TraceRecord {
+	return TraceRecord{
+		Time:       time.Now(),
+		Node:       p.MyId.Address,
+		Session:    p.session,
+		Repetition: p.Repetition,
+		Sender:     m.Sender.Address,
+		Receiver:   receiver,
+		Type:       m.Type,
+		RoundSent:  m.Round,
+		Round:      p.Round,
+		Outcome:    outcome,
+	}
+}
+
+// ReadTrace reads a message trace of json lines
+func ReadTrace(r io.Reader) ([]TraceRecord, error) {
+	records := make([]TraceRecord, 0)
+	err := readJSONLines(r, func(decode func(v interface{}) error) error {
+		record := TraceRecord{}
+		if err := decode(&record); err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+// DeliveryMatrix is what became of the messages of a type in a repetition, from every sender to every receiver
+type DeliveryMatrix struct {
+	Session    uint64
+	Repetition int
+	Type       string
+	Nodes      []string
+	Cells      map[string]map[string]string // the furthest outcome, by sender then receiver
+	first      time.Time
+}
+
+// Missing lists the pairs whose messages were sent but not accepted, as "sender -> receiver: outcome"
+func (d *DeliveryMatrix) Missing() []string {
+	missing := make([]string, 0)
+	for _, from := range d.Nodes {
+		for _, to := range d.Nodes {
+			outcome, ok := d.Cells[from][to]
+			if ok && from != to && traceRank[outcome] < traceRank[TRACE_ACCEPTED] {
+				missing = append(missing, fmt.Sprintf("%s -> %s: %s", from, to, outcome))
+			}
+		}
+	}
+	return missing
+}
+
+// AnalyzeTrace rebuilds the delivery matrices of every repetition and message type, in the order they started
+func AnalyzeTrace(records []TraceRecord) []*DeliveryMatrix {
+	type key struct {
+		session    uint64
+		repetition int
+		msgType    string
+	}
+	matrices := make(map[key]*DeliveryMatrix)
+	nodes := make(map[key]map[string]bool)
+	for _, r := range records {
+		k := key{r.Session, r.Repetition, r.Type}
+		d, ok := matrices[k]
+		if !ok {
+			d = &DeliveryMatrix{Session: r.Session, Repetition: r.Repetition, Type: r.Type,
+				Cells: make(map[string]map[string]string), first: r.Time}
+			matrices[k] = d
+			nodes[k] = make(map[string]bool)
+		}
+		if r.Time.Before(d.first) {
+			d.first = r.Time
+		}
+		nodes[k][r.Sender] = true
+		nodes[k][r.Receiver] = true
+		if d.Cells[r.Sender] == nil {
+			d.Cells[r.Sender] = make(map[string]string)
+		}
+		if current, ok := d.Cells[r.Sender][r.Receiver]; !ok || traceRank[r.Outcome] > traceRank[current] {
+			d.Cells[r.Sender][r.Receiver] = r.Outcome
+		}
+	}
+	result := make([]*DeliveryMatrix, 0, len(matrices))
+	for k, d := range matrices {
+		for addr, _ := range nodes[k] {
+			d.Nodes = append(d.Nodes, addr)
+		}
+		sort.Strings(d.Nodes)
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].first.Equal(result[j].first) {
+			return result[i].first.Before(result[j].first)
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
+
+// WriteDeliveryMatrices writes the matrices as text, a row per sender and a column per receiver
+func WriteDeliveryMatrices(w io.Writer, matrices []*DeliveryMatrix) {
+	fmt.Fprintf(w, "C counted, A accepted, E expired, I invalid, N not in initview, U unsynchronized, "+
+		"S sent but never received, D dropped by the fault injection, F send failed, . nothing sent\n")
+	for _, d := range matrices {
+		fmt.Fprintf(w, "\nsession %X, repetition %d: %s\n", d.Session, d.Repetition, d.Type)
+		width := len(fmt.Sprint(len(d.Nodes) - 1))
+		for i, addr := range d.Nodes {
+			fmt.Fprintf(w, "  %*d %s\n", width, i, addr)
+		}
+		header := make([]string, len(d.Nodes))
+		for i, _ := range d.Nodes {
+			header[i] = fmt.Sprintf("%*d", width, i)
+		}
+		fmt.Fprintf(w, "  %*s %s\n", width, "", strings.Join(header, " "))
+		for i, from := range d.Nodes {
+			row := make([]string, len(d.Nodes))
+			for j, to := range d.Nodes {
+				symbol := "."
+				if outcome, ok := d.Cells[from][to]; ok {
+					symbol = traceSymbol[outcome]
+				} else if from == to {
+					symbol = "-"
+				}
+				row[j] = fmt.Sprintf("%*s", width, symbol)
+			}
+			fmt.Fprintf(w, "  %*d %s\n", width, i, strings.Join(row, " "))
+		}
+		for _, missing := range d.Missing() {
+			fmt.Fprintf(w, "  missing %s\n", missing)
+		}
+	}
+}
+
+// AnalyzeTraceFiles reads the traces of the nodes and writes their delivery matrices
+func AnalyzeTraceFiles(files []string, w io.Writer) error {
+	all := make([]TraceRecord, 0)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		records, err := ReadTrace(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		all = append(all, records...)
+	}
+	WriteDeliveryMatrices(w, AnalyzeTrace(all))
+	return nil
+}
@@ -0,0 +1,88 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeTrace(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := func(seconds int, msgType string, from string, to string, outcome string) TraceRecord {
+		return TraceRecord{Time: start.Add(time.Duration(seconds) * time.Second), Node: from, Session: 7,
+			Sender: from, Receiver: to, Type: msgType, Outcome: outcome}
+	}
+	records := []TraceRecord{
+		record(3, "Sample View", "a:1", "b:2", TRACE_SENT),
+		record(3, "Sample View", "b:2", "a:1", TRACE_SENT),
+		record(4, "Sample View", "a:1", "b:2", TRACE_COUNTED),
+		record(1, "Election Challenge", "a:1", "b:2", TRACE_SENT),
+		record(2, "Election Challenge", "a:1", "b:2", TRACE_ACCEPTED),
+		record(2, "Election Challenge", "a:1", "b:2", TRACE_COUNTED),
+		// the accepted copy counts, not the expired one
+		record(2, "Election Challenge", "b:2", "a:1", TRACE_EXPIRED),
+		record(2, "Election Challenge", "b:2", "a:1", TRACE_ACCEPTED),
+		record(1, "Election Challenge", "b:2", "c:3", TRACE_DROPPED),
+	}
+	matrices := AnalyzeTrace(records)
+	if len(matrices) != 2 || matrices[0].Type != "Election Challenge" || matrices[1].Type != "Sample View" {
+		t.Fatalf("expected the challenges then the views, got %v", matrices)
+	}
+	challenges := matrices[0]
+	if len(challenges.Nodes) != 3 || challenges.Cells["a:1"]["b:2"] != TRACE_COUNTED || challenges.Cells["b:2"]["a:1"] != TRACE_ACCEPTED {
+		t.Errorf("unexpected challenges %+v", challenges)
+	}
+	if missing := challenges.Missing(); len(missing) != 1 || missing[0] != "b:2 -> c:3: dropped" {
+		t.Errorf("unexpected missing %v", missing)
+	}
+	if missing := matrices[1].Missing(); len(missing) != 1 || missing[0] != "b:2 -> a:1: sent" {
+		t.Errorf("unexpected missing %v", missing)
+	}
+
+	var b bytes.Buffer
+	WriteDeliveryMatrices(&b, matrices)
+	for _, line := range []string{"session 7, repetition 0: Election Challenge\n", "  2 c:3\n", "  0 - C .\n", "  1 A - D\n",
+		"  missing b:2 -> c:3: dropped\n", "  0 - C\n", "  1 S -\n"} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("missing %q in\n%s", line, b.String())
+		}
+	}
+}
+
+func TestTrace_receive(t *testing.T) {
+	defer func(dir string) { traceDir = dir }(traceDir)
+	if err := ConfigureTrace(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	var p ProtocolState
+	p.MyId.Address = "a:1"
+	p.Round = 10
+	p.offset = 2
+	p.openTrace()
+	msg := message.Message{Round: 3, Type: "Sample View", Sender: message.Identity{Address: "b:2"}}
+	if err := p.SendInMsg(msg, nil); err == nil {
+		t.Fatal("expected the message to expire")
+	}
+	p.closeLogs()
+	files, _ := filepath.Glob(filepath.Join(traceDir, "*.trace.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("expected a trace file, got %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := ReadTrace(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Outcome != TRACE_EXPIRED || records[0].Sender != "b:2" || records[0].Receiver != "a:1" ||
+		records[0].RoundSent != 3 || records[0].Round != 10 {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
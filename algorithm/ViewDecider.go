@@ -0,0 +1,124 @@
+package algorithm
+
+import (
+	"RVR/message"
+	"fmt"
+)
+
+// ViewDecider is the decision rule of the Compute step, it turns the scores
+// returned by Sample into the proposal of the leader and the new view of a node
+type ViewDecider interface {
+	// Propose returns the view the leader proposes in Gossip
+	Propose(scores map[uint64]float64) message.View
+	// Decide returns the new view, proposal is nil if no proposal is received
+	Decide(scores map[uint64]float64, proposal message.View, current message.View) message.View
+	String() string
+}
+
+const (
+	THRESHOLD_DECIDER = "threshold"
+	MAJORITY_DECIDER  = "majority"
+)
+
+// default thresholds of the threshold rule
+const (
+	DEFAULT_PROPOSE_THRESHOLD = 0.4
+	DEFAULT_ACCEPT_THRESHOLD  = 0.65
+	DEFAULT_SUPPORT_THRESHOLD = 0.16
+	DEFAULT_PROPOSAL_WEIGHT   = 0.5
+)
+
+// NewViewDecider builds the decider selected in the setup parameters,
+// thresholds and a weight that are not set, or out of range, fall back to the defaults;
+// setParam only takes the values used as they are
+func NewViewDecider(params *ProtocolRPCSetupParams) ViewDecider {
+	propose := params.ProposeThreshold
+	if propose == 0 {
+		propose = DEFAULT_PROPOSE_THRESHOLD
+	}
+	switch params.Decider {
+	case MAJORITY_DECIDER:
+		weight := params.ProposalWeight
+		if weight <= 0 || weight >= 1 {
+			weight = DEFAULT_PROPOSAL_WEIGHT
+		}
+		return &MajorityDecider{propose, weight}
+	default:
+		accept := params.AcceptThreshold
+		if accept == 0 {
+			accept = DEFAULT_ACCEPT_THRESHOLD
+		}
+		support := params.SupportThreshold
+		if support == 0 {
+			support = DEFAULT_SUPPORT_THRESHOLD
+		}
+		return &ThresholdDecider{propose, accept, support}
+	}
+}
+
+// ThresholdDecider is the rule of the paper: an id is accepted on its own score,
+// or with a lower score if the leader also proposes it (or, without a proposal,
+// if it is already in the view)
+type ThresholdDecider struct {
+	ProposeThreshold float64 // the leader proposes the ids scoring above it
+	AcceptThreshold  float64 // ids scoring above it are always accepted
+	SupportThreshold float64 // ids scoring at least this are accepted with the support of the proposal
+}
+
+// selectByScore returns the ids whose score passes the check
+func selectByScore(scores map[uint64]float64, pass func(score float64) bool) message.View {
+	ids := make([]uint64, 0)
+	for uuid, score := range scores {
+		if pass(score) {
+			ids = append(ids, uuid)
+		}
+	}
+	return message.NewView(ids)
+}
+
+func (d *ThresholdDecider) Propose(scores map[uint64]float64) message.View {
+	return selectByScore(scores, func(score float64) bool { return score > d.ProposeThreshold })
+}
+
+func (d *ThresholdDecider) Decide(scores map[uint64]float64, proposal message.View, current message.View) message.View {
+	accepted := selectByScore(scores, func(score float64) bool { return score > d.AcceptThreshold })
+	supported := selectByScore(scores, func(score float64) bool { return score >= d.SupportThreshold })
+	if proposal != nil {
+		return accepted.Union(supported.Intersect(proposal))
+	}
+	return accepted.Union(supported.Intersect(current))
+}
+
+func (d *ThresholdDecider) String() string {
+	return fmt.Sprintf("threshold (propose > %f, accept > %f, support >= %f)",
+		d.ProposeThreshold, d.AcceptThreshold, d.SupportThreshold)
+}
+
+// MajorityDecider weighs the score of an id against the vote of the leader:
+// an id is accepted if (score + w * proposed) / (1 + w) > 1/2, with 0 < w < 1,
+// that is a proposed id needs a score above (1-w)/2 and any other id a score
+// above (1+w)/2. Without a proposal, the current view takes the place of the
+// leader's vote. The bands move with w instead of being fixed, so w can be
+// lowered to tolerate a higher f, at the price of a slower convergence.
+type MajorityDecider struct {
+	ProposeThreshold float64
+	ProposalWeight   float64
+}
+
+func (d *MajorityDecider) Propose(scores map[uint64]float64) message.View {
+	return selectByScore(scores, func(score float64) bool { return score > d.ProposeThreshold })
+}
+
+func (d *MajorityDecider) Decide(scores map[uint64]float64, proposal message.View, current message.View) message.View {
+	votes := proposal
+	if votes == nil {
+		votes = current
+	}
+	voted := selectByScore(scores, func(score float64) bool { return (score+d.ProposalWeight)/(1+d.ProposalWeight) > 0.5 })
+	unvoted := selectByScore(scores, func(score float64) bool { return score/(1+d.ProposalWeight) > 0.5 })
+	return unvoted.Union(voted.Intersect(votes))
+}
+
+func (d *MajorityDecider) String() string {
+	return fmt.Sprintf("majority (propose > %f, proposal weight %f)", d.ProposeThreshold, d.ProposalWeight)
+}
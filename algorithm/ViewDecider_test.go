@@ -0,0 +1,60 @@
+package algorithm
+
+import (
+	"sort"
+	"testing"
+)
+
+func sortedView(view []uint64) []uint64 {
+	sorted := append([]uint64(nil), view...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func sameView(a []uint64, b []uint64) bool {
+	a, b = sortedView(a), sortedView(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i, _ := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestThresholdDecider(t *testing.T) {
+	d := NewViewDecider(&DefaultSetupParams)
+	scores := map[uint64]float64{1: 0.9, 2: 0.5, 3: 0.3, 4: 0.1, 5: 0.2}
+	if view := d.Propose(scores); !sameView(view, []uint64{1, 2}) {
+		t.Errorf("wrong proposal: %v", view)
+	}
+	if view := d.Decide(scores, []uint64{2, 3, 4}, nil); !sameView(view, []uint64{1, 2, 3}) {
+		t.Errorf("wrong view with proposal: %v", view)
+	}
+	if view := d.Decide(scores, nil, []uint64{1, 4, 5}); !sameView(view, []uint64{1, 5}) {
+		t.Errorf("wrong view without proposal: %v", view)
+	}
+
+	// thresholds come from the setup parameters
+	params := DefaultSetupParams
+	params.AcceptThreshold = 0.4
+	d = NewViewDecider(&params)
+	if view := d.Decide(scores, []uint64{}, nil); !sameView(view, []uint64{1, 2}) {
+		t.Errorf("accept threshold not applied: %v", view)
+	}
+}
+
+func TestMajorityDecider(t *testing.T) {
+	params := DefaultSetupParams
+	params.Decider = MAJORITY_DECIDER
+	d := NewViewDecider(&params)
+	scores := map[uint64]float64{1: 0.9, 2: 0.4, 3: 0.05}
+	if view := d.Decide(scores, []uint64{2, 3}, nil); !sameView(view, []uint64{1, 2}) {
+		t.Errorf("wrong view with proposal: %v", view)
+	}
+	if view := d.Decide(scores, nil, []uint64{3}); !sameView(view, []uint64{1}) {
+		t.Errorf("wrong view without proposal: %v", view)
+	}
+}
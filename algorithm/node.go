@@ -29,13 +29,34 @@ type ProtocolState struct {
 	l              int
 	x              int // The number of rounds for Gossip to run
 	delta          float64
+	repetitions    int    // 0 for 6 ln(2/delta) + 1
+	session        uint64 // identifies the run, commitments are bound to it
+	decider        ViewDecider // the decision rule of the Compute step
+	sampleEncoding string      // how Sample View carries the view, SAMPLE_ENCODING_FULL or SAMPLE_ENCODING_BLOOM
+	bloomFPRate    float64
+	gossipMode     string // GOSSIP_MODE_FULL or GOSSIP_MODE_DELTA
+	deltaCells     int    // cells of the IBLT in the gossip adverts
+	relayFanout    int    // 0 disables the relay of the proposal
+	relayTTL       int
+	startAt        time.Time  // the agreed start, the zero time starts at once
+	drift          *roundDrift // how far the peers are ahead, see tick
+	netem          *netem     // fault injection on the sent messages, nil for none
+	events         eventSink  // the structured event log, nil to print the events
+	trace          *traceSink // the trace of the messages sent and received, nil for none
+	proposalHops   int // relays the proposal of the current repetition went through, -1 if not received
+	pendingChanges []MembershipChange         // announced joins and leaves, applied at their repetition
+	joiners        map[uint64]MembershipChange // nodes that joined through this node, waiting for admission
+	params         ProtocolRPCSetupParams      // as received in Setup, kept for the checkpoints
+	checkpointDir  string                      // saves a Checkpoint at every repetition if set
+	crashed        bool                        // the protocol panicked, a spawner may restart the node
 	initView       []message.Identity
 	ControlAddress string
 
 	// protocol state
 	Round        int
+	Repetition   int
 	inQueue      []message.Message
-	View         []uint64
+	View         message.View
 	lock         sync.RWMutex
 	ticker       <-chan time.Time
 	idToAddrMap  map[uint64]string // use to check whether in initview
@@ -55,6 +76,19 @@ type ProtocolState struct {
 	PingEstimate   float64 // use filter to estimate ping
 	FailToSend     int
 	ExpiredMsg     int
+	Drift          int // the last estimate of the rounds the peers are ahead
+	CatchUps       int // times the node found itself lagging and caught up
+	CaughtUp       int // rounds run without waiting for the ticker
+	NetemDropped   int // messages lost to the fault injection
+	ClockOffset    time.Duration // the clock of the node minus the controller's, as the controller estimated
+
+	SampleStats    SampleStats
+	GossipStats    GossipStats
+
+	// election outcome of every repetition, at most MAX_HISTORY of them
+	ElectionHistory []ElectionRecord
+	// view at the end of every repetition, at most MAX_HISTORY of them
+	History []RepetitionRecord
 }
 
 type ProtocolRPCSetupParams struct {
@@ -67,6 +101,29 @@ type ProtocolRPCSetupParams struct {
 	Delta         float64
 	Id            message.Identity
 	InitView      []message.Identity
+	Session       uint64 // chosen by the controller at every setup
+
+	// the decision rule of the Compute step, see ViewDecider
+	Decider          string // THRESHOLD_DECIDER or MAJORITY_DECIDER
+	ProposeThreshold float64
+	AcceptThreshold  float64
+	SupportThreshold float64
+	ProposalWeight   float64 // only for MAJORITY_DECIDER
+
+	SampleEncoding string  // SAMPLE_ENCODING_FULL or SAMPLE_ENCODING_BLOOM
+	BloomFPRate    float64 // target false positive rate of the bloom filters
+
+	GossipMode string // GOSSIP_MODE_FULL or GOSSIP_MODE_DELTA
+	DeltaCells int    // cells of the IBLT, decodes differences up to about DeltaCells/1.5 ids
+
+	// relay of the proposal in Gossip, see relayProposal
+	RelayFanout int // number of peers a node forwards the proposal to, 0 lets only the leader send
+	RelayTTL    int // the largest number of relays a proposal goes through
+
+	StartAt     time.Time     // the wall-clock time all nodes start at, in the controller's clock, see StartAt
+	ClockOffset time.Duration // set for every node, its clock minus the controller's
+
+	Repetitions int // repetitions of a run, 0 for 6 ln(2/Delta) + 1
 }
 
 func (p *ProtocolRPCSetupParams) String() string {
@@ -74,13 +131,21 @@ func (p *ProtocolRPCSetupParams) String() string {
 	return fmt.Sprintf("-----------------------\n"+
 		"Using parameter:\n"+
 		"RoundDuration: %dms\n"+
+		"Offset: %d\n"+
 		"F: %f\n"+
 		"G: %f\n"+
 		"L: %d\n"+
 		"X: %d\n"+
 		"Delta: %f\n"+
+		"Decider: %s\n"+
+		"Sample encoding: %s (false positive rate %f)\n"+
+		"Gossip mode: %s (%d cells)\n"+
+		"Gossip relay: fanout %d, ttl %d\n"+
+		"Repetitions: %d (0 for 6 ln(2/Delta) + 1)\n"+
 		"-----------------------\n",
-		p.RoundDuration/time.Millisecond, p.F, p.G, p.L, p.X, p.Delta)
+		p.RoundDuration/time.Millisecond, p.Offset, p.F, p.G, p.L, p.X, p.Delta, NewViewDecider(p).String(),
+		p.SampleEncoding, p.BloomFPRate, p.GossipMode, p.DeltaCells,
+		p.RelayFanout, p.RelayTTL, p.Repetitions)
 }
 
 func (p *ProtocolState) String() string {
@@ -95,8 +160,25 @@ func (p *ProtocolState) String() string {
 		"message received: %d\n"+
 		"view size: %d\n"+
 		"CurrentProto: %s\n"+
+		"round drift: %d, caught up %d rounds in %d catch-ups\n"+
+		"dropped by netem: %d\n"+
+		"elections succeeded: %d/%d\n"+
+		"sample: %s\n"+
+		"gossip: %s\n"+
 		"-----------------------\n",
-		p.MyId.GetUUID(), p.MyId.Address, p.Round, p.Finished, p.MsgCount, p.ByteCount, p.LargestMsgSize, p.MsgReceived, len(p.View), p.CurrentProto)
+		p.MyId.GetUUID(), p.MyId.Address, p.Round, p.Finished, p.MsgCount, p.ByteCount, p.LargestMsgSize, p.MsgReceived, len(p.View), p.CurrentProto,
+		p.Drift, p.CaughtUp, p.CatchUps, p.NetemDropped,
+		p.electionSucceeded(), len(p.ElectionHistory), p.SampleStats.String(), p.GossipStats.String())
+}
+
+func (p *ProtocolState) electionSucceeded() int {
+	count := 0
+	for i, _ := range p.ElectionHistory {
+		if p.ElectionHistory[i].Succeeded {
+			count++
+		}
+	}
+	return count
 }
 
 func GetOutboundAddr() string {
@@ -110,64 +192,21 @@ func GetOutboundAddr() string {
 	return localAddr.IP.String()
 }
 
-func (p *ProtocolState) testPing(size int, addr string, timeout time.Duration, rtv chan int) int {
-	data := make([]byte, size)
-	rand.Read(data)
-	startTime := time.Now()
-	err := RpcCall(addr, "ProtocolState.BlackHole", data, nil, timeout)
-	if err != nil {
-		if rtv != nil {
-			rtv <- -1
-		}
-		return -1
-	} else {
-		finTime := int(time.Now().Sub(startTime))
-		if rtv != nil {
-			rtv <- finTime
-		}
-		return finTime
-	}
-}
-
-func (p *ProtocolState) pingReport(size int) PingValueReport {
-	// this function returns an array of ping values to every peer
-	reportLen := 0
-	reportChan := make(chan int, 0)
-	for _, peer := range p.initView {
-		reportLen++
-		go func(addr string) {
-			p.testPing(size, addr, p.roundDuration, reportChan)
-		}(peer.Address)
-	}
-	report := make(PingValueReport, reportLen)
-	for i := 0; i < reportLen; i++ {
-		report[i] = <-reportChan
-	}
-	return report
-}
-
-func (p *ProtocolState) PingReport(size int, rtv *int) error {
-	go func() {
-		report := p.pingReport(size)
-		RpcCall(p.ControlAddress, "ControllerState.AcceptReport", report, nil, p.roundDuration)
-	}()
-	return nil
-}
-
 func (p *ProtocolState) localMonitor(recur int) bool {
 	if recur == 0 {
 		p.Malicious = true
 		return false
 	}
-	report := p.pingReport(2000)
+	report := p.probe(ProbeParams{Sizes: []int{2000}, Samples: 1, Timeout: p.roundDuration})
 	failure := 0
-	for i, _ := range report {
-		if report[i] <= 0 || report[i] >= int(p.roundDuration) {
+	for _, link := range report.Links {
+		if link.Lost > 0 {
 			failure++
 		}
 	}
 	if float64(failure) > (float64(len(p.initView))*p.g + 5) {
-		fmt.Printf("%s: bad round, recur = %d, failure count: %d\n", p.MyId.Address, recur, failure)
+		p.logFields(LEVEL_WARN, "bad_round", map[string]interface{}{"failures": failure},
+			"%s: bad round, recur = %d, failure count: %d", p.MyId.Address, recur, failure)
 		time.Sleep(p.roundDuration)
 		return p.localMonitor(recur - 1)
 	} else {
@@ -224,26 +263,45 @@ func (p *ProtocolState) SendInMsg(msg message.Message, rtv *int) error {
 		p.lock.RUnlock()
 		p.lock.Lock()
 		p.ExpiredMsg++
+		p.traceReceive(&msg, TRACE_EXPIRED)
 		p.lock.Unlock()
 		return errors.New("Trying to enroll an expired msg")
 	}
 	p.lock.RUnlock()
+	verifyStart := time.Now()
 	err := msg.Verify()
+	processMetrics.Observe("rvr_verify_seconds", "time to verify the signature of a received message",
+		labels("node", p.MyId.Address), time.Since(verifyStart).Seconds())
 	if err != nil {
+		p.lock.RLock()
+		p.traceReceive(&msg, TRACE_INVALID)
+		p.lock.RUnlock()
 		return err
 	}
+	// the initview changes as nodes join and leave during the run
+	p.lock.RLock()
 	if _, ok := p.idToAddrMap[msg.Sender.GetUUID()]; !ok {
+		p.traceReceive(&msg, TRACE_NOT_IN_INITVIEW)
+		p.lock.RUnlock()
 		return fmt.Errorf("Not in initview.\n")
 	}
+	p.lock.RUnlock()
 	p.lock.Lock()
 	defer p.lock.Unlock()
-	if msg.Round > p.Round+p.offset && p.CurrentProto != "Gossip" {
-		fmt.Printf("%s: unsynchronized, Malicious, at round %d, received msg at round %d from %s\n",
+	// a node that lags behind its peers catches up instead of being marked malicious
+	lagging := p.observeRound(msg.Sender.GetUUID(), msg.Type, msg.Round)
+	if msg.Round > p.Round+p.offset && p.CurrentProto != "Gossip" && !lagging {
+		p.logFields(LEVEL_ERROR, "unsynchronized", map[string]interface{}{"msg_round": msg.Round, "from": msg.Sender.Address},
+			"%s: unsynchronized, Malicious, at round %d, received msg at round %d from %s",
 			p.MyId.Address, p.Round, msg.Round, msg.Sender.Address)
 		p.Malicious = true
+		p.traceReceive(&msg, TRACE_UNSYNCHRONIZED)
 	} else {
 		p.inQueue = append(p.inQueue, msg)
 		p.MsgReceived++
+		processMetrics.Add("rvr_phase_messages_received_total", "messages received, by the phase of the node",
+			labels("node", p.MyId.Address, "phase", phaseLabel(p.CurrentProto)), 1)
+		p.traceReceive(&msg, TRACE_ACCEPTED)
 	}
 	return nil
 }
@@ -261,14 +319,24 @@ func (p *ProtocolState) init() {
 	p.g = 0.005 // <0.01
 	p.l = 2
 	p.delta = 0.01
+	p.decider = &ThresholdDecider{DEFAULT_PROPOSE_THRESHOLD, DEFAULT_ACCEPT_THRESHOLD, DEFAULT_SUPPORT_THRESHOLD}
+	p.sampleEncoding = SAMPLE_ENCODING_FULL
+	p.bloomFPRate = 0.01
+	p.gossipMode = GOSSIP_MODE_FULL
+	p.deltaCells = DEFAULT_DELTA_CELLS
+	p.relayFanout = 0
+	p.relayTTL = DEFAULT_RELAY_TTL
+	p.resetDrift()
 	// p.x is only updated when the initview is updated
 
 	// init states
 	p.Round = 1
 	p.inQueue = make([]message.Message, 0)
 	p.initView = make([]message.Identity, 0)
-	p.View = make([]uint64, 0)
+	p.View = message.View{}
 	p.idToAddrMap = make(map[uint64]string)
+	p.pendingChanges = make([]MembershipChange, 0)
+	p.joiners = make(map[uint64]MembershipChange)
 	p.ticker = time.Tick(p.roundDuration) // TODO: use a separate function to start ticker
 
 	// init the rpc server
@@ -296,6 +364,8 @@ func (p *ProtocolState) init() {
 	for _, id := range p.initView {
 		p.idToAddrMap[id.GetUUID()] = id.Address
 	}
+	p.openEvents()
+	p.openTrace()
 
 	log.Printf("RPC Server started, Listening on %s", p.MyId.Address)
 } // this function starts the protocol at once
@@ -316,9 +386,12 @@ func (p *ProtocolState) GetReady() {
 
 	p.MyId = message.Identity{myIP + myPort, x509.MarshalPKCS1PublicKey(&p.privateKey.PublicKey)}
 
+	p.openEvents()
+	p.openTrace()
+
 	// report to controller
 	RpcCall(p.ControlAddress, "ControllerState.Register", p.MyId, nil, p.roundDuration*time.Duration(p.l))
-	fmt.Printf("Node ready to receive instructions, Address: %s\n", p.MyId.Address)
+	p.logEvent(LEVEL_INFO, "ready", "Node ready to receive instructions, Address: %s", p.MyId.Address)
 
 }
 
@@ -326,6 +399,10 @@ func (p *ProtocolState) Setup(state ProtocolRPCSetupParams, rtv *int) error {
 	// this function sets up the server
 	// setup parameters based on the incoming instruction
 	// copy the state parameters
+	p.params = state
+	p.startAt = state.StartAt
+	p.ClockOffset = state.ClockOffset
+	p.resetDrift()
 	p.roundDuration = state.RoundDuration
 	p.offset = state.Offset
 	p.f = state.F
@@ -333,36 +410,66 @@ func (p *ProtocolState) Setup(state ProtocolRPCSetupParams, rtv *int) error {
 	p.l = state.L
 	p.x = state.X
 	p.delta = state.Delta
+	p.repetitions = state.Repetitions
+	p.session = state.Session
+	p.decider = NewViewDecider(&state)
+	p.sampleEncoding = state.SampleEncoding
+	p.bloomFPRate = state.BloomFPRate
+	p.gossipMode = state.GossipMode
+	p.deltaCells = state.DeltaCells
+	p.relayFanout = state.RelayFanout
+	p.relayTTL = state.RelayTTL
 	p.initView = state.InitView
 	// initialize the state parameters
 	p.Round = 0
+	p.Repetition = 0
+	p.pendingChanges = make([]MembershipChange, 0)
+	p.joiners = make(map[uint64]MembershipChange)
 	p.inQueue = make([]message.Message, 0)
-	p.View = make([]uint64, 0)
+	p.View = message.View{}
 	p.idToAddrMap = make(map[uint64]string)
+	p.ElectionHistory = make([]ElectionRecord, 0)
+	p.SampleStats = SampleStats{}
+	p.GossipStats = GossipStats{}
+	p.History = make([]RepetitionRecord, 0)
 
 	for i, _ := range p.initView {
 		p.idToAddrMap[p.initView[i].GetUUID()] = p.initView[i].Address
 	}
 
-	fmt.Printf("Node setup done, initview length: %d\n", len(p.initView))
+	p.logEvent(LEVEL_INFO, "setup", "Node setup done, initview length: %d", len(p.initView))
 
 	return nil
 }
 
-func (p *ProtocolState) SetView(view []uint64, rtv *int) error {
-	p.View = view
+func (p *ProtocolState) SetView(view message.View, rtv *int) error {
+	p.View = message.NewView(view)
 	return nil
 }
 
 func (p *ProtocolState) Start(command int, rtv *int) error {
 	// this function starts the algorithm
+	if time.Until(p.startAt.Add(p.ClockOffset)) > 0 {
+		// wait for the agreed start
+		return p.StartAt(p.startAt, rtv)
+	}
 	// start the ticker
 	p.ticker = time.Tick(p.roundDuration)
+	p.launch()
+	return nil
+}
+
+// launch runs View Reconciliation and the local monitor on the ticker that is set
+func (p *ProtocolState) launch() {
 	// invoke View Reconciliation (asynchrously)
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
 				// fail gracefully
+				p.logEvent(LEVEL_ERROR, "crashed", "%s crashed: %s", p.MyId.Address, r)
+				p.lock.Lock()
+				p.crashed = true
+				p.lock.Unlock()
 				p.Finished = true
 				p.FinishTime = time.Now()
 				p.Exit(1, nil)
@@ -384,16 +491,16 @@ func (p *ProtocolState) Start(command int, rtv *int) error {
 			p.localMonitor(p.l)
 		}
 		if p.Malicious{
-			fmt.Printf("%s is marked as Malicious. \n", p.MyId.Address)
+			p.logEvent(LEVEL_WARN, "malicious", "%s is marked as Malicious. ", p.MyId.Address)
 		}else{
-			fmt.Printf("%s finished. \n", p.MyId.Address)
+			p.logEvent(LEVEL_INFO, "finished", "%s finished. ", p.MyId.Address)
 		}
 	}()
-	return nil
 }
 
 func (p *ProtocolState) Exit(command int, rtv *int) error {
 	p.ExitSignal <- true
+	p.closeLogs()
 	return nil
 }
 
@@ -429,23 +536,24 @@ func (p *ProtocolState) removeFromInitView(addr string) {
 }
 func (p *ProtocolState) sendMsgToPeerAsync(m message.Message, addr string) {
 	go func() {
+		if !p.emulate(addr, int(m.Size())) {
+			p.traceSend(&m, addr, TRACE_DROPPED)
+			return
+		}
 		err := RpcCall(addr, "ProtocolState.SendInMsg", m, nil, p.roundDuration)
+		p.traceSend(&m, addr, sendOutcome(err))
 		// measurement
 		if err != nil {
 			p.lock.Lock()
 			p.FailToSend++
-			if err.Error() == "Not in initview.\n" {
+			// a relayed message is rejected for its original sender, not for us
+			if err.Error() == "Not in initview.\n" && m.Sender.GetUUID() == p.MyId.GetUUID() {
 				p.removeFromInitView(addr)
 			}
 			p.lock.Unlock()
 		} else {
 			p.lock.Lock()
-			p.MsgCount++
-			size := int(m.Size())
-			p.ByteCount += size
-			if p.LargestMsgSize < size {
-				p.LargestMsgSize = size
-			}
+			p.countSent(int(m.Size()))
 			p.lock.Unlock()
 		}
 	}()
@@ -455,7 +563,13 @@ func (p *ProtocolState) sendMsgToPeerWithTrial(m message.Message, addr string, t
 	if trial <= 0 {
 		return fmt.Errorf("Fail to send to %s.\n", addr)
 	}
+	if !p.emulate(addr, int(m.Size())) {
+		// lost on the emulated link, the sender cannot tell and does not try again
+		p.traceSend(&m, addr, TRACE_DROPPED)
+		return nil
+	}
 	err := RpcCall(addr, "ProtocolState.SendInMsg", m, nil, p.roundDuration)
+	p.traceSend(&m, addr, sendOutcome(err))
 	// measurement
 	if err != nil {
 		p.lock.Lock()
@@ -464,12 +578,7 @@ func (p *ProtocolState) sendMsgToPeerWithTrial(m message.Message, addr string, t
 		return p.sendMsgToPeerWithTrial(m, addr, trial-1)
 	} else {
 		p.lock.Lock()
-		p.MsgCount++
-		size := int(m.Size())
-		p.ByteCount += size
-		if p.LargestMsgSize < size {
-			p.LargestMsgSize = size
-		}
+		p.countSent(int(m.Size()))
 		p.lock.Unlock()
 		return nil
 	}
@@ -479,7 +588,7 @@ func (p *ProtocolState) updateWithPeers(peers []string, maxRound int) {
 	// every Round advertise one of my peer to all my peers
 	// succeed if heard from every one
 	for totalRound := maxRound; totalRound > 0; totalRound-- {
-		<-p.ticker // Round counter
+		p.tick() // Round counter
 		p.lock.Lock()
 		p.Round++
 		// process all messages
@@ -515,17 +624,32 @@ func (p *ProtocolState) updateWithPeers(peers []string, maxRound int) {
 
 func (p *ProtocolState) sketch() (round int, duration time.Duration){
 	// sketch the run and return the computed duration
-	repetity := int(6.0*math.Log(2/p.delta) + 1)
-	round = repetity * (1 + electionSketch(p, 1) + sampleSketch(p) + gossipSketch(p))
+	repetity := p.repetitionCount()
+	round = repetity * repetitionSketch(p)
 	duration = time.Duration(round) * p.roundDuration
 	return
 }
 
+// repetitionCount is the number of repetitions of a run, 6 ln(2/delta) + 1 unless set
+func (p *ProtocolState) repetitionCount() int {
+	if p.repetitions > 0 {
+		return p.repetitions
+	}
+	return int(6.0*math.Log(2/p.delta) + 1)
+}
+
+// repetitionSketch is the number of rounds of one repetition
+func repetitionSketch(p *ProtocolState) int {
+	return 1 + electionSketch(p, 1) + sampleSketch(p) + gossipSketch(p)
+}
+
 func (p *ProtocolState) viewReconciliation() {
-	fmt.Printf("%s starting RVR protocol, initial View length: %d\n", p.MyId.Address, len(p.View))
-	repetity := int(6.0*math.Log(2/p.delta) + 1)
+	p.logEvent(LEVEL_INFO, "started", "%s starting RVR protocol, initial View length: %d", p.MyId.Address, len(p.View))
+	repetity := p.repetitionCount()
 	// repetity /= 32
-	for i := 0; i < repetity; i++ {
+	left := false
+	// a node that joined during the run starts at its admission repetition
+	for i := p.Repetition; i < repetity; i++ {
 		select {
 		case <-p.ExitSignal:
 			p.ExitSignal <- true
@@ -535,18 +659,41 @@ func (p *ProtocolState) viewReconciliation() {
 		}
 
 		p.lock.Lock()
-		<-p.ticker
+		p.Repetition = i
+		p.lock.Unlock()
+		if p.applyMembership(i) {
+			p.logEvent(LEVEL_INFO, "left", "%s leaving at repetition %d", p.MyId.Address, i)
+			left = true
+			break
+		}
+		if p.checkpointDir != "" {
+			if err := p.saveCheckpoint(); err != nil {
+				p.logEvent(LEVEL_ERROR, "checkpoint_failed", "%s unable to save checkpoint: %s", p.MyId.Address, err)
+			}
+		}
+
+		// wait for the round without holding the lock, tick may take it
+		p.tick()
+		p.lock.Lock()
 		p.Round++
 		p.lock.Unlock()
 
 		p.lock.Lock()
 		p.CurrentProto = "Election"
 		p.lock.Unlock()
-		leader := DoElection(p, 1)
+		leader, record := doElectionWithRecord(p, 1)
+		record.Repetition = i
+		p.lock.Lock()
+		p.ElectionHistory = append(p.ElectionHistory, record)
+		if len(p.ElectionHistory) > MAX_HISTORY {
+			p.ElectionHistory = p.ElectionHistory[len(p.ElectionHistory)-MAX_HISTORY:]
+		}
+		p.lock.Unlock()
 		if leader.Public_key == nil{
-			fmt.Printf("Leader Election failed, round %d.\n", p.Round)
+			p.logEvent(LEVEL_WARN, "election_failed", "Leader Election failed, round %d.", p.Round)
 		}else{
-			fmt.Printf("Leader Election succeeded, round %d.\n", p.Round )
+			p.logFields(LEVEL_INFO, "election_succeeded", map[string]interface{}{"leader": leader.Address},
+				"Leader Election succeeded, round %d.", p.Round)
 		}
 
 		p.lock.Lock()
@@ -555,12 +702,7 @@ func (p *ProtocolState) viewReconciliation() {
 		scores := Sample(p)
 		if bytes.Equal(leader.Public_key, p.MyId.Public_key) {
 			if scores != nil {
-				p.View = make([]uint64, 0)
-				for uuid, score := range scores {
-					if score > 0.4 {
-						p.View = append(p.View, uuid)
-					}
-				}
+				p.View = p.decider.Propose(scores)
 			}
 		}
 
@@ -572,46 +714,33 @@ func (p *ProtocolState) viewReconciliation() {
 		p.lock.Lock()
 		p.CurrentProto = "Compute"
 		p.lock.Unlock()
-		// build a check map
-		proposalMap := make(map[uint64]bool)
-		for _, uuid := range proposal {
-			proposalMap[uuid] = true
-		}
 		if scores != nil {
-			if proposal != nil {
-				p.View = make([]uint64, 0)
-				for uuid, score := range scores {
-					if score > 0.65 || (score >= 0.16 && proposalMap[uuid]) {
-						p.View = append(p.View, uuid)
-					}
-				}
-			} else {
-				newView := make([]uint64, 0)
-				for uuid, score := range scores {
-					if score > 0.65 {
-						newView = append(newView, uuid)
-					}
-				}
-				for _, uuid := range p.View {
-					if scores[uuid] <= 0.65 && scores[uuid] >= 0.16 {
-						newView = append(newView, uuid)
-					}
-				}
-				p.View = newView
-			}
+			p.View = p.decider.Decide(scores, proposal, p.View)
 		}
+		p.recordRepetition(i, &leader, proposal)
 	}
-	fmt.Printf("%s finishing RVR protocol, final View length: %d\n", p.MyId.Address, len(p.View))
+	p.logFields(LEVEL_INFO, "view_final", map[string]interface{}{"view_size": len(p.View), "digest": fmt.Sprintf("%X", p.View.Digest())},
+		"%s finishing RVR protocol, final View length: %d", p.MyId.Address, len(p.View))
 	p.Finished = true
 	p.FinishTime = time.Now()
 	pRound, pTime := p.sketch()
-	fmt.Printf("Proposed Rounds: %d, actual rounds: %d; proposed time %s, actual time %s\n", pRound, p.Round, pTime, p.FinishTime.Sub(p.StartTime) )
+	p.logEvent(LEVEL_INFO, "rounds", "Proposed Rounds: %d, actual rounds: %d; proposed time %s, actual time %s", pRound, p.Round, pTime, p.FinishTime.Sub(p.StartTime))
+	if left {
+		p.Exit(1, nil)
+	}
 }
 
 func StartNode(controlAddress string, exitSignal chan bool) *ProtocolState {
+	return StartCheckpointedNode(controlAddress, "", exitSignal)
+}
+
+// StartCheckpointedNode starts a node that saves a Checkpoint to the directory at every repetition
+func StartCheckpointedNode(controlAddress string, checkpointDir string, exitSignal chan bool) *ProtocolState {
 	p := ProtocolState{}
 	p.ControlAddress = controlAddress
 	p.ExitSignal = exitSignal
+	p.checkpointDir = checkpointDir
+	processMetrics.trackNode(&p)
 	go p.GetReady()
 	return &p
 }
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 )
 
 func main() {
@@ -12,16 +13,73 @@ func main() {
 	var exitSignal = make(chan bool, 4)
 	mode := flag.String("mode", "node", "choose a value between node/controller")
 	controlAddress := flag.String("server", "172.24.200.200:9696", "controller's address")
+	checkpointDir := flag.String("checkpoint", "", "directory the nodes save their checkpoints to")
+	restart := flag.Bool("restart", false, "let the spawner restart crashed nodes from their checkpoints")
+	recoverFile := flag.String("recover", "", "checkpoint file to recover a node from")
+	apiAddress := flag.String("http", "", "address the controller serves its HTTP API at, like :8080")
+	metricsAddress := flag.String("metrics", "", "address the process serves its Prometheus metrics at, like :9100")
+	scenarioFile := flag.String("scenario", "", "scenario file the controller runs instead of reading the console")
+	events := flag.String("events", "", "directory the nodes write their event logs to, or \"controller\" to collect them there")
+	eventLevel := flag.String("event-level", "info", "lowest level of the logged events: debug/info/warn/error")
+	trace := flag.String("trace", "", "directory the nodes write the trace of every message they send and receive to")
+	results := flag.String("results", "", "directory the controller saves its finished runs to, for --mode=analyze")
+	csvDir := flag.String("csv", "", "directory --mode=analyze writes its tables to as csv")
 	flag.Parse()
+	if err := algorithm.ConfigureResults(*results); err != nil {
+		log.Fatalf("Unable to save the runs: %s\n", err)
+	}
+	if err := algorithm.ConfigureTrace(*trace); err != nil {
+		log.Fatalf("Unable to trace the messages: %s\n", err)
+	}
+	if err := algorithm.ConfigureEvents(*events, *eventLevel); err != nil {
+		log.Fatalf("Unable to log the events: %s\n", err)
+	}
+	if *metricsAddress != "" {
+		algorithm.ServeMetrics(*metricsAddress)
+	}
 	switch *mode {
 	case "node":
-		algorithm.StartNode(*controlAddress, exitSignal)
+		if *recoverFile != "" {
+			if _, err := algorithm.RecoverNode(*controlAddress, *recoverFile, exitSignal); err != nil {
+				log.Fatalf("Unable to recover: %s\n", err)
+			}
+		} else {
+			algorithm.StartCheckpointedNode(*controlAddress, *checkpointDir, exitSignal)
+		}
 
 	case "controller":
-		algorithm.StartServer(exitSignal)
+		if *scenarioFile != "" {
+			failed, err := algorithm.StartScenario(*scenarioFile, exitSignal)
+			if err != nil {
+				log.Fatalf("Scenario stopped: %s\n", err)
+			}
+			if failed > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+		algorithm.StartServerWithAPI(*apiAddress, exitSignal)
 
 	case "spawner":
-		algorithm.StartSpawner(*controlAddress, exitSignal)
+		algorithm.StartRestartingSpawner(*controlAddress, *checkpointDir, *restart, exitSignal)
+
+	case "merge-events":
+		if err := algorithm.MergeEventFiles(flag.Args(), os.Stdout); err != nil {
+			log.Fatalf("Unable to merge the events: %s\n", err)
+		}
+		return
+
+	case "analyze":
+		if err := algorithm.AnalyzeRunFiles(flag.Args(), *csvDir, os.Stdout); err != nil {
+			log.Fatalf("Unable to analyze the runs: %s\n", err)
+		}
+		return
+
+	case "analyze-trace":
+		if err := algorithm.AnalyzeTraceFiles(flag.Args(), os.Stdout); err != nil {
+			log.Fatalf("Unable to analyze the trace: %s\n", err)
+		}
+		return
 
 	default:
 		log.Fatalf("Unsupported mode: %s\n Try:node/controller\n", mode)
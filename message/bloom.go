@@ -0,0 +1,100 @@
+package message
+
+import (
+	"errors"
+	"math"
+)
+
+// BloomFilter is a compressed membership encoding of a view. It never misses a
+// member of the view, but it may report ids outside of it (false positives).
+type BloomFilter struct {
+	Bits   []byte
+	Hashes int // number of hash functions
+}
+
+// NewBloomFilter sizes a filter for n ids with the target false positive rate
+func NewBloomFilter(n int, fpRate float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	bits := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	hashes := int(math.Round(bits / float64(n) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	if hashes > 255 {
+		hashes = 255
+	}
+	return &BloomFilter{make([]byte, (int(bits)+7)/8), hashes}
+}
+
+// BloomFromView builds the filter of a view
+func BloomFromView(v View, fpRate float64) *BloomFilter {
+	b := NewBloomFilter(len(v), fpRate)
+	for _, id := range v {
+		b.Add(id)
+	}
+	return b
+}
+
+// mix64 is the splitmix64 finaliser, used to derive the second hash of an id
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// position of the i-th hash of id, by double hashing
+func (b *BloomFilter) position(id uint64, i int) uint64 {
+	h1 := mix64(id)
+	h2 := mix64(h1) | 1
+	return (h1 + uint64(i)*h2) % uint64(len(b.Bits)*8)
+}
+
+func (b *BloomFilter) Add(id uint64) {
+	for i := 0; i < b.Hashes; i++ {
+		pos := b.position(id, i)
+		b.Bits[pos/8] |= 1 << (pos % 8)
+	}
+}
+
+// Test tells whether id may be in the filter
+func (b *BloomFilter) Test(id uint64) bool {
+	if len(b.Bits) == 0 {
+		return false
+	}
+	for i := 0; i < b.Hashes; i++ {
+		pos := b.position(id, i)
+		if b.Bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FalsePositiveRate estimates the false positive rate once n ids are added
+func (b *BloomFilter) FalsePositiveRate(n int) float64 {
+	m := float64(len(b.Bits) * 8)
+	k := float64(b.Hashes)
+	return math.Pow(1-math.Exp(-k*float64(n)/m), k)
+}
+
+// Encode returns the number of hashes followed by the bits
+func (b *BloomFilter) Encode() []byte {
+	return append([]byte{byte(b.Hashes)}, b.Bits...)
+}
+
+func DecodeBloomFilter(data []byte) (*BloomFilter, error) {
+	if len(data) < 2 || data[0] == 0 {
+		return nil, errors.New("bloom filter: malformed encoding")
+	}
+	bits := make([]byte, len(data)-1)
+	copy(bits, data[1:])
+	return &BloomFilter{bits, int(data[0])}, nil
+}
@@ -0,0 +1,42 @@
+package message
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	ids := make([]uint64, 1000)
+	for i, _ := range ids {
+		ids[i] = rand.Uint64()
+	}
+	view := NewView(ids)
+	filter := BloomFromView(view, 0.01)
+	decoded, err := DecodeBloomFilter(filter.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range view {
+		if !decoded.Test(id) {
+			t.Fatalf("member %d missing from the filter", id)
+		}
+	}
+
+	falsePositives := 0
+	trials := 20000
+	for i := 0; i < trials; i++ {
+		if decoded.Test(rand.Uint64()) {
+			falsePositives++
+		}
+	}
+	rate := float64(falsePositives) / float64(trials)
+	if rate > 0.02 {
+		t.Errorf("false positive rate %f, expecting about 0.01", rate)
+	}
+	if estimate := decoded.FalsePositiveRate(len(view)); estimate > 0.015 {
+		t.Errorf("estimated false positive rate %f, expecting about 0.01", estimate)
+	}
+	if len(filter.Encode()) >= view.EncodedSize() {
+		t.Errorf("filter of %d bytes is not smaller than the view of %d bytes", len(filter.Encode()), view.EncodedSize())
+	}
+}
@@ -0,0 +1,35 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"golang.org/x/crypto/sha3"
+)
+
+// Commit computes the commitment to a nonce for the commit-reveal phases.
+// The commitment is hash(nonce || sender || round || session), so the nonce
+// is hidden until it is revealed, and a commitment cannot be replayed by
+// another sender, in another round or in another session.
+func Commit(nonce []byte, sender uint64, round int, session uint64) []byte {
+	hash := sha3.New256()
+	temp := make([]byte, 8)
+	// prefix the length so that the nonce cannot be confused with the fields after it
+	binary.LittleEndian.PutUint64(temp, uint64(len(nonce)))
+	hash.Write(temp)
+	hash.Write(nonce)
+	binary.LittleEndian.PutUint64(temp, sender)
+	hash.Write(temp)
+	binary.LittleEndian.PutUint64(temp, uint64(round))
+	hash.Write(temp)
+	binary.LittleEndian.PutUint64(temp, session)
+	hash.Write(temp)
+	return hash.Sum(nil)
+}
+
+// VerifyCommitment checks whether the revealed nonce opens the commitment
+func VerifyCommitment(commitment []byte, nonce []byte, sender uint64, round int, session uint64) bool {
+	if commitment == nil || nonce == nil {
+		return false
+	}
+	return bytes.Equal(Commit(nonce, sender, round, session), commitment)
+}
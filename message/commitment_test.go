@@ -0,0 +1,66 @@
+package message
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/bits"
+	"testing"
+)
+
+func TestCommit_Verify(t *testing.T) {
+	nonce := make([]byte, 32)
+	rand.Read(nonce)
+	commitment := Commit(nonce, 42, 7, 99)
+	if !VerifyCommitment(commitment, nonce, 42, 7, 99) {
+		t.Error("the nonce does not open its own commitment")
+	}
+
+	other := make([]byte, 32)
+	rand.Read(other)
+	if VerifyCommitment(commitment, other, 42, 7, 99) {
+		t.Error("a different nonce opens the commitment")
+	}
+	if VerifyCommitment(commitment, nonce, 43, 7, 99) {
+		t.Error("the commitment is not bound to the sender")
+	}
+	if VerifyCommitment(commitment, nonce, 42, 8, 99) {
+		t.Error("the commitment is not bound to the round")
+	}
+	if VerifyCommitment(commitment, nonce, 42, 7, 100) {
+		t.Error("the commitment is not bound to the session")
+	}
+	if VerifyCommitment(commitment, nil, 42, 7, 99) {
+		t.Error("an empty reveal opens the commitment")
+	}
+}
+
+func TestCommit_Hiding(t *testing.T) {
+	nonce := make([]byte, 32)
+	rand.Read(nonce)
+	commitment := Commit(nonce, 42, 7, 99)
+	if len(commitment) != 32 {
+		t.Errorf("unexpected commitment length %d", len(commitment))
+	}
+	for i := 0; i+4 <= len(nonce); i++ {
+		if bytes.Contains(commitment, nonce[i:i+4]) {
+			t.Fatalf("the commitment contains the nonce bytes at %d", i)
+		}
+	}
+
+	// flipping a single bit of the nonce should change about half of the commitment,
+	// so nothing about the nonce can be read off its commitment
+	totalFlips := 0
+	trials := 256
+	for i := 0; i < trials; i++ {
+		flipped := append([]byte(nil), nonce...)
+		flipped[i/8] ^= 1 << uint(i%8)
+		other := Commit(flipped, 42, 7, 99)
+		for j, _ := range other {
+			totalFlips += bits.OnesCount8(other[j] ^ commitment[j])
+		}
+	}
+	avg := float64(totalFlips) / float64(trials)
+	if avg < 112 || avg > 144 {
+		t.Errorf("commitment bits are correlated with the nonce, average flips: %f", avg)
+	}
+}
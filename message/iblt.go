@@ -0,0 +1,182 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// number of hash functions of an IBLT, every hash owns a third of the cells
+const IBLT_HASHES = 3
+
+// IBLT is an invertible bloom lookup table of a view. Subtracting the table of
+// another view and decoding the result gives the difference of the two views,
+// as long as the difference is small compared with the number of cells.
+type IBLT struct {
+	Count   []int64
+	IdSum   []uint64
+	HashSum []uint64
+}
+
+// NewIBLT allocates a table, cells is rounded up to a multiple of IBLT_HASHES
+func NewIBLT(cells int) *IBLT {
+	if cells < IBLT_HASHES {
+		cells = IBLT_HASHES
+	}
+	cells = (cells + IBLT_HASHES - 1) / IBLT_HASHES * IBLT_HASHES
+	return &IBLT{make([]int64, cells), make([]uint64, cells), make([]uint64, cells)}
+}
+
+func IBLTFromView(v View, cells int) *IBLT {
+	t := NewIBLT(cells)
+	for _, id := range v {
+		t.Insert(id)
+	}
+	return t
+}
+
+func (t *IBLT) cell(id uint64, i int) int {
+	part := len(t.Count) / IBLT_HASHES
+	return i*part + int(mix64(id+uint64(i)*0x9e3779b97f4a7c15)%uint64(part))
+}
+
+func (t *IBLT) update(id uint64, delta int64) {
+	check := mix64(^id)
+	for i := 0; i < IBLT_HASHES; i++ {
+		c := t.cell(id, i)
+		t.Count[c] += delta
+		t.IdSum[c] ^= id
+		t.HashSum[c] ^= check
+	}
+}
+
+func (t *IBLT) Insert(id uint64) {
+	t.update(id, 1)
+}
+
+func (t *IBLT) Delete(id uint64) {
+	t.update(id, -1)
+}
+
+// Subtract returns t - o, both tables must have the same number of cells
+func (t *IBLT) Subtract(o *IBLT) (*IBLT, error) {
+	if len(t.Count) != len(o.Count) {
+		return nil, errors.New("iblt: tables of different sizes")
+	}
+	result := NewIBLT(len(t.Count))
+	for i, _ := range t.Count {
+		result.Count[i] = t.Count[i] - o.Count[i]
+		result.IdSum[i] = t.IdSum[i] ^ o.IdSum[i]
+		result.HashSum[i] = t.HashSum[i] ^ o.HashSum[i]
+	}
+	return result, nil
+}
+
+func (t *IBLT) pure(c int) bool {
+	return (t.Count[c] == 1 || t.Count[c] == -1) && t.HashSum[c] == mix64(^t.IdSum[c])
+}
+
+// Decode peels a subtracted table t - o. It returns the ids only in the view of
+// t and the ids only in the view of o, or an error if the table cannot be fully
+// peeled: the difference is too large for the table, or the table is forged.
+// A table of n cells peels at most 2n ids, and never the same id twice.
+func (t *IBLT) Decode() (onlyT View, onlyO View, err error) {
+	work := NewIBLT(len(t.Count))
+	copy(work.Count, t.Count)
+	copy(work.IdSum, t.IdSum)
+	copy(work.HashSum, t.HashSum)
+
+	plus, minus := make([]uint64, 0), make([]uint64, 0)
+	peeled := make(map[uint64]bool)
+	queue := make([]int, 0)
+	for c, _ := range work.Count {
+		if work.pure(c) {
+			queue = append(queue, c)
+		}
+	}
+	for len(queue) > 0 {
+		c := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if !work.pure(c) {
+			continue
+		}
+		id, sign := work.IdSum[c], work.Count[c]
+		if peeled[id] {
+			return nil, nil, errors.New("iblt: an id peeled twice")
+		}
+		if len(peeled) >= 2*len(work.Count) {
+			return nil, nil, errors.New("iblt: more ids than the table can hold")
+		}
+		peeled[id] = true
+		if sign > 0 {
+			plus = append(plus, id)
+		} else {
+			minus = append(minus, id)
+		}
+		work.update(id, -sign)
+		for i := 0; i < IBLT_HASHES; i++ {
+			if other := work.cell(id, i); work.pure(other) {
+				queue = append(queue, other)
+			}
+		}
+	}
+	for c, _ := range work.Count {
+		if work.Count[c] > 1 || work.Count[c] < -1 {
+			return nil, nil, errors.New("iblt: a cell holds several ids after peeling")
+		}
+		if work.Count[c] != 0 || work.IdSum[c] != 0 || work.HashSum[c] != 0 {
+			return nil, nil, errors.New("iblt: the difference is too large for the table")
+		}
+	}
+	return NewView(plus), NewView(minus), nil
+}
+
+// Encode writes the number of cells, then every cell: a zero byte if it is
+// empty, otherwise a one byte, the zigzag varint count and both sums
+func (t *IBLT) Encode() []byte {
+	buf := make([]byte, 0, 2*len(t.Count))
+	temp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(temp, uint64(len(t.Count)))
+	buf = append(buf, temp[:n]...)
+	for c, _ := range t.Count {
+		if t.Count[c] == 0 && t.IdSum[c] == 0 && t.HashSum[c] == 0 {
+			buf = append(buf, 0)
+			continue
+		}
+		buf = append(buf, 1)
+		n = binary.PutVarint(temp, t.Count[c])
+		buf = append(buf, temp[:n]...)
+		binary.LittleEndian.PutUint64(temp, t.IdSum[c])
+		buf = append(buf, temp[:8]...)
+		binary.LittleEndian.PutUint64(temp, t.HashSum[c])
+		buf = append(buf, temp[:8]...)
+	}
+	return buf
+}
+
+func DecodeIBLT(data []byte) (*IBLT, error) {
+	cells, n := binary.Uvarint(data)
+	if n <= 0 || cells == 0 || cells%IBLT_HASHES != 0 || cells > uint64(len(data)) {
+		return nil, errors.New("iblt: malformed size")
+	}
+	data = data[n:]
+	t := NewIBLT(int(cells))
+	for c, _ := range t.Count {
+		if len(data) == 0 {
+			return nil, errors.New("iblt: truncated encoding")
+		}
+		flag := data[0]
+		data = data[1:]
+		if flag == 0 {
+			continue
+		}
+		count, n := binary.Varint(data)
+		if n <= 0 || len(data) < n+16 {
+			return nil, errors.New("iblt: malformed cell")
+		}
+		t.Count[c] = count
+		t.IdSum[c] = binary.LittleEndian.Uint64(data[n:])
+		t.HashSum[c] = binary.LittleEndian.Uint64(data[n+8:])
+		data = data[n+16:]
+	}
+	return t, nil
+}
@@ -0,0 +1,77 @@
+package message
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func randomView(n int) View {
+	ids := make([]uint64, n)
+	for i, _ := range ids {
+		ids[i] = rand.Uint64()
+	}
+	return NewView(ids)
+}
+
+func TestIBLT_Difference(t *testing.T) {
+	common := randomView(1000)
+	onlyA := randomView(20)
+	onlyB := randomView(15)
+	a := common.Union(onlyA)
+	b := common.Union(onlyB)
+
+	tableA := IBLTFromView(a, 120)
+	tableB, err := DecodeIBLT(IBLTFromView(b, 120).Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := tableA.Subtract(tableB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plus, minus, err := diff.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plus.Equal(onlyA) || !minus.Equal(onlyB) {
+		t.Errorf("wrong difference: %d/%d ids, expecting %d/%d", len(plus), len(minus), len(onlyA), len(onlyB))
+	}
+	// applying the difference to b gives a
+	if !b.Union(plus).Difference(minus).Equal(a) {
+		t.Error("the difference does not reconcile the views")
+	}
+}
+
+func TestIBLT_Overflow(t *testing.T) {
+	a := randomView(300)
+	b := randomView(300)
+	diff, _ := IBLTFromView(a, 30).Subtract(IBLTFromView(b, 30))
+	if _, _, err := diff.Decode(); err == nil {
+		t.Error("a difference larger than the table is reported as decoded")
+	}
+	if _, err := IBLTFromView(a, 30).Subtract(IBLTFromView(b, 60)); err == nil {
+		t.Error("tables of different sizes are subtracted")
+	}
+}
+
+func TestIBLT_Forged(t *testing.T) {
+	// with 3 cells every id hashes to all of them: peeling x from either end cell leaves
+	// x alone in the middle one, which would be peeled again and again
+	x := uint64(0x1234)
+	check := mix64(^x)
+	forged := &IBLT{Count: []int64{-1, -2, -1}, IdSum: []uint64{x, 0, x}, HashSum: []uint64{check, 0, check}}
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := forged.Decode()
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("a forged table is reported as decoded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("decoding a forged table does not end")
+	}
+}
@@ -34,12 +34,14 @@ type Message struct {
 	Round     int      // Round count
 	Sender    Identity // the Identity of the Sender
 	Signature []byte   // Signature for the entire Message, all fields should be included
-	View      []uint64 // in Sample, this is the View of the Sender, and in Gossip, this is the View of the leader
+	View      View     // in Sample, this is the View of the Sender, and in Gossip, this is the View of the leader
 	Nonce     []byte   // in Elect, challenge and solution header; in Sample, Nonce,
 	Proof     [][]byte // the off-path hashes to Elect's puzzle, the first field should be the challenge of the rcver, and
 						// the hash of all bytes one be one should be below the intended difficulty
-	Order []bool // the order of merging the off-path hashes
-	Type  string // indicate the purpose of the message (for easier message handling)
+	Order  []bool // the order of merging the off-path hashes
+	Sketch []byte // in Sample, the compressed View of the Sender (see BloomFilter) when the full View is not sent
+	Type   string // indicate the purpose of the message (for easier message handling)
+	Hops   int    // in Gossip, the number of relays the message went through; not signed, every relay increments it
 }
 
 func (m *Message) getDigest() []byte {
@@ -48,8 +50,9 @@ func (m *Message) getDigest() []byte {
 	hash_tool.Write([]byte(m.Sender.Address))
 	hash_tool.Write(m.Sender.Public_key)
 
+	// the view travels in canonical order, so it is hashed in canonical order
 	temp := make([]byte, 8)
-	for _, id := range m.View {
+	for _, id := range m.View.canonical() {
 		binary.LittleEndian.PutUint64(temp, id)
 		hash_tool.Write(temp)
 	}
@@ -57,6 +60,7 @@ func (m *Message) getDigest() []byte {
 		hash_tool.Write(header)
 	}
 	hash_tool.Write(m.Nonce)
+	hash_tool.Write(m.Sketch)
 	for _, d := range m.Order {
 		if d {
 			hash_tool.Write([]byte{1})
@@ -104,7 +108,8 @@ func (m *Message) Size() uintptr{
 	size += unsafe.Sizeof(m)
 	size += m.Sender.Size()
 	size += uintptr(len(m.Signature)) * reflect.TypeOf(m.Signature).Elem().Size()
-	size += uintptr(len(m.View)) * reflect.TypeOf(m.View).Elem().Size()
+	size += uintptr(m.View.EncodedSize())
+	size += uintptr(len(m.Sketch))
 
 	return size
 }
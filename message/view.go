@@ -0,0 +1,203 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/sha3"
+	"sort"
+)
+
+// View is a set of node UUIDs kept in canonical order: ascending and without duplicates.
+// On the wire it is delta-varint encoded, see Encode.
+type View []uint64
+
+// NewView returns the canonical view of the ids, the input is not modified
+func NewView(ids []uint64) View {
+	view := make(View, len(ids))
+	copy(view, ids)
+	sort.Slice(view, func(i, j int) bool { return view[i] < view[j] })
+	return view.dedup()
+}
+
+func (v View) dedup() View {
+	if len(v) == 0 {
+		return v
+	}
+	last := 0
+	for i := 1; i < len(v); i++ {
+		if v[i] != v[last] {
+			last++
+			v[last] = v[i]
+		}
+	}
+	return v[:last+1]
+}
+
+// IsCanonical tells whether the view is sorted and without duplicates
+func (v View) IsCanonical() bool {
+	for i := 1; i < len(v); i++ {
+		if v[i] <= v[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+func (v View) canonical() View {
+	if v.IsCanonical() {
+		return v
+	}
+	return NewView(v)
+}
+
+// Contains tells whether id is in the view, which has to be canonical as NewView,
+// DecodeView and the set operations return it
+func (v View) Contains(id uint64) bool {
+	i := sort.Search(len(v), func(i int) bool { return v[i] >= id })
+	return i < len(v) && v[i] == id
+}
+
+// Digest is the SHA3-256 hash of the canonical view, equal views have equal digests
+func (v View) Digest() []byte {
+	hash := sha3.New256()
+	temp := make([]byte, 8)
+	for _, id := range v.canonical() {
+		binary.LittleEndian.PutUint64(temp, id)
+		hash.Write(temp)
+	}
+	return hash.Sum(nil)
+}
+
+func (v View) Equal(o View) bool {
+	v, o = v.canonical(), o.canonical()
+	if len(v) != len(o) {
+		return false
+	}
+	for i, _ := range v {
+		if v[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// merge walks both canonical views in order, keep decides which ids end up in the result
+func (v View) merge(o View, keep func(inV bool, inO bool) bool) View {
+	v, o = v.canonical(), o.canonical()
+	result := make(View, 0)
+	i, j := 0, 0
+	for i < len(v) || j < len(o) {
+		switch {
+		case j == len(o) || (i < len(v) && v[i] < o[j]):
+			if keep(true, false) {
+				result = append(result, v[i])
+			}
+			i++
+		case i == len(v) || o[j] < v[i]:
+			if keep(false, true) {
+				result = append(result, o[j])
+			}
+			j++
+		default:
+			if keep(true, true) {
+				result = append(result, v[i])
+			}
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func (v View) Union(o View) View {
+	return v.merge(o, func(inV bool, inO bool) bool { return true })
+}
+
+func (v View) Intersect(o View) View {
+	return v.merge(o, func(inV bool, inO bool) bool { return inV && inO })
+}
+
+// Difference returns the ids in v but not in o
+func (v View) Difference(o View) View {
+	return v.merge(o, func(inV bool, inO bool) bool { return inV && !inO })
+}
+
+// Encode returns the compact encoding of the view: the number of ids, then the
+// gaps between consecutive ids, all as unsigned varints
+func (v View) Encode() []byte {
+	v = v.canonical()
+	buf := make([]byte, 0, v.EncodedSize())
+	temp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(temp, uint64(len(v)))
+	buf = append(buf, temp[:n]...)
+	var last uint64
+	for _, id := range v {
+		n = binary.PutUvarint(temp, id-last)
+		buf = append(buf, temp[:n]...)
+		last = id
+	}
+	return buf
+}
+
+func uvarintSize(x uint64) int {
+	size := 1
+	for x >= 0x80 {
+		x >>= 7
+		size++
+	}
+	return size
+}
+
+// EncodedSize is the length of Encode, without encoding the view
+func (v View) EncodedSize() int {
+	v = v.canonical()
+	size := uvarintSize(uint64(len(v)))
+	var last uint64
+	for _, id := range v {
+		size += uvarintSize(id - last)
+		last = id
+	}
+	return size
+}
+
+func DecodeView(data []byte) (View, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errors.New("view: malformed length")
+	}
+	data = data[n:]
+	if count > uint64(len(data)) {
+		return nil, errors.New("view: length exceeds the encoding")
+	}
+	view := make(View, count)
+	var last uint64
+	for i, _ := range view {
+		gap, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("view: malformed id")
+		}
+		if i > 0 && gap == 0 {
+			return nil, errors.New("view: duplicate id")
+		}
+		if last+gap < last {
+			return nil, errors.New("view: id out of range")
+		}
+		data = data[n:]
+		last += gap
+		view[i] = last
+	}
+	return view, nil
+}
+
+func (v View) GobEncode() ([]byte, error) {
+	return v.Encode(), nil
+}
+
+func (v *View) GobDecode(data []byte) error {
+	view, err := DecodeView(data)
+	if err != nil {
+		return err
+	}
+	*v = view
+	return nil
+}
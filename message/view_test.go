@@ -0,0 +1,81 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestView_SetOperations(t *testing.T) {
+	a := NewView([]uint64{5, 1, 3, 3, 9})
+	b := NewView([]uint64{3, 4, 5})
+	if !a.Equal(View{1, 3, 5, 9}) || !a.IsCanonical() {
+		t.Errorf("view not canonical: %v", a)
+	}
+	if u := a.Union(b); !u.Equal(View{1, 3, 4, 5, 9}) {
+		t.Errorf("wrong union: %v", u)
+	}
+	if i := a.Intersect(b); !i.Equal(View{3, 5}) {
+		t.Errorf("wrong intersection: %v", i)
+	}
+	if d := a.Difference(b); !d.Equal(View{1, 9}) {
+		t.Errorf("wrong difference: %v", d)
+	}
+	if !a.Contains(9) || a.Contains(4) {
+		t.Error("wrong membership")
+	}
+	if !bytes.Equal(a.Digest(), View{9, 5, 3, 1}.Digest()) {
+		t.Error("digest depends on the order")
+	}
+	if bytes.Equal(a.Digest(), b.Digest()) {
+		t.Error("different views have the same digest")
+	}
+}
+
+func TestView_Encode(t *testing.T) {
+	view := make([]uint64, 500)
+	for i, _ := range view {
+		view[i] = rand.Uint64()
+	}
+	v := NewView(view)
+	data := v.Encode()
+	if len(data) != v.EncodedSize() {
+		t.Errorf("encoded size %d, expecting %d", len(data), v.EncodedSize())
+	}
+	// UUIDs are uniformly random, so the gaps save about log2(n) bits per id
+	var plain bytes.Buffer
+	gob.NewEncoder(&plain).Encode([]uint64(v))
+	if len(data) >= plain.Len() {
+		t.Errorf("encoding is not compact: %d bytes, %d bytes without the gaps", len(data), plain.Len())
+	}
+	decoded, err := DecodeView(data)
+	if err != nil || !decoded.Equal(v) {
+		t.Errorf("decoding failed: %v", err)
+	}
+	if _, err := DecodeView(data[:len(data)/2]); err == nil {
+		t.Error("truncated encoding accepted")
+	}
+	// a gap past the largest id would wrap around and break the order
+	wrapped := binary.AppendUvarint(binary.AppendUvarint(binary.AppendUvarint(nil, 2), 5), math.MaxUint64)
+	if _, err := DecodeView(wrapped); err == nil {
+		t.Error("decreasing ids accepted")
+	}
+}
+
+func TestView_InMessage(t *testing.T) {
+	msg := Message{Round: 3, View: NewView([]uint64{7, 2, 2, 40})}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Message
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.View.Equal(msg.View) {
+		t.Errorf("view changed on the wire: %v", decoded.View)
+	}
+}